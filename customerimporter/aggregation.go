@@ -0,0 +1,100 @@
+package customerimporter
+
+import (
+	"fmt"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Aggregations of the email domains.
+const (
+	AggregationExact       = "exact"       // Count the domains as they are, e.g. mail.google.com and google.com apart.
+	AggregationRegistrable = "registrable" // Count the registrable domains (eTLD+1), e.g. mail.google.com as google.com.
+	AggregationBoth        = "both"        // Count the registrable domains along with their exact domains.
+)
+
+// DefaultAggregation is the aggregation used when DOMAIN_AGGREGATION isn't set.
+const DefaultAggregation = AggregationExact
+
+// Aggregations lists the supported aggregations.
+var Aggregations = []string{AggregationExact, AggregationRegistrable, AggregationBoth}
+
+// validateAggregation returns an error if the aggregation isn't supported. An empty aggregation stands for exact.
+func validateAggregation(aggregation string) error {
+	switch aggregation {
+	case "", AggregationExact, AggregationRegistrable, AggregationBoth:
+		return nil
+	default:
+		return fmt.Errorf("unknown aggregation %q, expected one of %q", aggregation, Aggregations)
+	}
+}
+
+// registrableDomain returns the registrable domain (eTLD+1) of the normalized domain, the part of it an organisation
+// registers under a public suffix, e.g. google.com for mail.google.com and example.co.uk for www.example.co.uk.
+// The public suffixes come from the snapshot of the Public Suffix List embedded in golang.org/x/net/publicsuffix.
+// A domain which is a public suffix itself, e.g. co.uk, is returned as is.
+func registrableDomain(domain string) string {
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return domain
+	}
+	return registrable
+}
+
+// aggregateDomains aggregates the normalized domains counted in the map as configured, converts them to the
+// configured form and orders them. It returns the ordered domains along with the number of distinct domains, which
+// are the registrable domains unless the exact domains are counted.
+func aggregateDomains(emailDomains map[string]int, config *Config) ([]DomainCount, int, error) {
+	var (
+		counts     = make(map[string]int, len(emailDomains))
+		subdomains map[string]map[string]int // Exact domains of the registrable domains, if both are reported.
+	)
+	if config.Aggregation == AggregationBoth {
+		subdomains = make(map[string]map[string]int)
+	}
+
+	for domain, count := range emailDomains {
+		key := aggregationKey(domain, config)
+		counts[key] += count
+
+		if subdomains != nil {
+			if subdomains[key] == nil {
+				subdomains[key] = make(map[string]int)
+			}
+			subdomains[key][formatDomain(domain, config.DomainForm)] += count
+		}
+	}
+
+	domains, err := sortDomainCounts(counts, config.SortOrder, config.Top)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if subdomains != nil { // Top limits the registrable domains, all their exact domains are reported.
+		for i := range domains {
+			if domains[i].Subdomains, err = sortDomainCounts(subdomains[domains[i].Domain], config.SortOrder, 0); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	return domains, len(counts), nil
+}
+
+// aggregationKey returns the domain the normalized domain is counted under: the domain or its registrable domain,
+// in the configured form.
+func aggregationKey(domain string, config *Config) string {
+	if config.Aggregation == AggregationRegistrable || config.Aggregation == AggregationBoth {
+		domain = registrableDomain(domain)
+	}
+	return formatDomain(domain, config.DomainForm)
+}
+
+// aggregateCounts returns the counts of the normalized domains added up under their aggregation keys.
+func aggregateCounts(counts map[string]int, config *Config) map[string]int {
+	aggregated := make(map[string]int, len(counts))
+	for domain, count := range counts {
+		aggregated[aggregationKey(domain, config)] += count
+	}
+	return aggregated
+}
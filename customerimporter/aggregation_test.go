@@ -0,0 +1,113 @@
+package customerimporter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegistrableDomain(t *testing.T) {
+	testCases := []struct {
+		name          string
+		domain        string
+		expectedValue string
+	}{
+		{name: "Registrable domain", domain: "google.com", expectedValue: "google.com"},
+		{name: "Subdomain", domain: "mail.google.com", expectedValue: "google.com"},
+		{name: "Multi-label public suffix", domain: "www.something.co.uk", expectedValue: "something.co.uk"},
+		{name: "Public suffix", domain: "co.uk", expectedValue: "co.uk"},
+		{name: "Private public suffix", domain: "pawlobanano.github.io", expectedValue: "pawlobanano.github.io"},
+		{name: "Punycode", domain: "www.xn--e1afmkfd.xn--p1ai", expectedValue: "xn--e1afmkfd.xn--p1ai"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given, When
+			domain := registrableDomain(tc.domain)
+
+			// Then
+			if domain != tc.expectedValue {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, domain)
+			}
+		})
+	}
+}
+
+func TestAggregateDomains(t *testing.T) {
+	emailDomains := map[string]int{
+		"google.com":                3,
+		"mail.google.com":           2,
+		"something.co.uk":           1,
+		"shop.something.co.uk":      1,
+		"co.uk":                     1,
+		"www.xn--e1afmkfd.xn--p1ai": 1,
+	}
+
+	testCases := []struct {
+		name                    string
+		config                  *Config
+		expectedValue           []DomainCount
+		expectedDistinctDomains int
+	}{
+		{
+			name:   "Exact",
+			config: &Config{Aggregation: AggregationExact, SortOrder: SortCountDesc, Top: 2},
+			expectedValue: []DomainCount{
+				{Domain: "google.com", Count: 3},
+				{Domain: "mail.google.com", Count: 2},
+			},
+			expectedDistinctDomains: 6,
+		},
+		{
+			name:   "Registrable",
+			config: &Config{Aggregation: AggregationRegistrable, SortOrder: SortCountDesc},
+			expectedValue: []DomainCount{
+				{Domain: "google.com", Count: 5},
+				{Domain: "something.co.uk", Count: 2},
+				{Domain: "co.uk", Count: 1},
+				{Domain: "xn--e1afmkfd.xn--p1ai", Count: 1},
+			},
+			expectedDistinctDomains: 4,
+		},
+		{
+			name:   "Registrable in Unicode",
+			config: &Config{Aggregation: AggregationRegistrable, SortOrder: SortNameDesc, Top: 1, DomainForm: DomainFormUnicode},
+			expectedValue: []DomainCount{
+				{Domain: "пример.рф", Count: 1},
+			},
+			expectedDistinctDomains: 4,
+		},
+		{
+			name:   "Both",
+			config: &Config{Aggregation: AggregationBoth, SortOrder: SortCountDesc, Top: 2},
+			expectedValue: []DomainCount{
+				{Domain: "google.com", Count: 5, Subdomains: []DomainCount{
+					{Domain: "google.com", Count: 3},
+					{Domain: "mail.google.com", Count: 2},
+				}},
+				{Domain: "something.co.uk", Count: 2, Subdomains: []DomainCount{
+					{Domain: "shop.something.co.uk", Count: 1},
+					{Domain: "something.co.uk", Count: 1},
+				}},
+			},
+			expectedDistinctDomains: 4,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given, When
+			domains, distinctDomains, err := aggregateDomains(emailDomains, tc.config)
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if !reflect.DeepEqual(domains, tc.expectedValue) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, domains)
+			}
+			if distinctDomains != tc.expectedDistinctDomains {
+				t.Errorf("Test %s failed. Expected distinct domains: %v, Got: %v", tc.name, tc.expectedDistinctDomains, distinctDomains)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package customerimporter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Modes of reading the CSV files.
+const (
+	ReaderModeBuffered = "buffered" // A single goroutine reads the records through a buffered reader.
+	ReaderModeChunked  = "chunked"  // The file is split into byte ranges read by a goroutine each.
+	ReaderModeMmap     = "mmap"     // The file is memory-mapped, then read in chunks, which the fast path slices.
+)
+
+// DefaultReaderMode is the reader mode used when READER_MODE isn't set.
+const DefaultReaderMode = ReaderModeBuffered
+
+// ReaderModes lists the supported reader modes.
+var ReaderModes = []string{ReaderModeBuffered, ReaderModeChunked, ReaderModeMmap}
+
+// minChunkSize is the smallest byte range read by a goroutine of its own, smaller files aren't split.
+const minChunkSize = 1 << 20
+
+// chunkScanSize is the size of the blocks read while looking for the record boundaries.
+const chunkScanSize = 64 * 1024
+
+// validateReaderMode returns an error if the reader mode isn't supported. An empty mode stands for buffered.
+func validateReaderMode(mode string) error {
+	switch mode {
+	case "", ReaderModeBuffered, ReaderModeChunked, ReaderModeMmap:
+		return nil
+	default:
+		return fmt.Errorf("unknown reader mode %q, expected one of %q", mode, ReaderModes)
+	}
+}
+
+// recordSource is a CSV reader of the data, or of a byte range of it, along with the number of lines before the data
+// it reads, so the line numbers it reports are absolute. The fast path reads the data out of the mapped bytes or the
+// buffered reader instead, if any, starting past the lines the CSV reader read.
+type recordSource struct {
+	*csv.Reader
+	lineOffset int
+	mapped     []byte
+	buffered   *bufio.Reader
+	linesRead  int
+}
+
+// sources returns the readers of the records: the byte ranges of the file when it is read in chunks, the reader
+// itself otherwise. Each source is read by a feeder goroutine of its own, which sends the records to the workers in
+// batches of Config.BatchSize and stops reading once the context is done.
+func (r *csvFileReader) sources() []recordSource {
+	if len(r.chunks) > 0 {
+		return r.chunks
+	}
+	return []recordSource{{Reader: r.Reader, mapped: r.mapped, buffered: r.buffered, linesRead: r.headerLines}}
+}
+
+// seekableFile is a regular file whose byte ranges can be read concurrently, e.g. an *os.File.
+type seekableFile interface {
+	io.ReaderAt
+	Stat() (os.FileInfo, error)
+}
+
+// chunk is a byte range of the file holding whole records.
+type chunk struct {
+	start, end int64
+	lines      int // Lines of the file before the chunk.
+}
+
+// splitIntoChunks splits the records of the file, past the header line read by the reader, into byte ranges aligned
+// to the record boundaries, read by a recordSource each. The records aren't split when the file is too small, when it
+// is compressed or decoded from another encoding than UTF-8, or when a quote may not start a quoted field (lazy quotes
+// or comment lines), as the boundaries are found by the parity of the quotes. When the file is memory-mapped, the
+// sources hold the mapped bytes of their records too, whether the records are split or not.
+func splitIntoChunks(log Logger, config *Config, reader *csvFileReader, file seekableFile) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !info.Mode().IsRegular():
+		log.Info("Reading the input in chunks isn't possible, it isn't a regular file.")
+		return nil
+	case reader.compression != CompressionNone:
+		log.Info("Reading the file in chunks isn't possible, it is compressed.", "compression", reader.compression)
+		return nil
+	case reader.LazyQuotes || reader.Comment != 0:
+		log.Info("Reading the file in chunks isn't possible with lazy quotes or comment lines.")
+		return nil
+	}
+
+	head := make([]byte, len(utf8BOM))
+	n, err := file.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	head = head[:n]
+
+	enc, err := lookupEncoding(config.InputEncoding)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(head, utf16BEBOM) || bytes.HasPrefix(head, utf16LEBOM) || enc != unicode.UTF8 {
+		log.Info("Reading the file in chunks isn't possible, it is decoded from another encoding.", "encoding", config.InputEncoding)
+		return nil
+	}
+
+	// The header line, the lines before it and the stripped BOM were read by the reader.
+	start := reader.InputOffset()
+	if !config.KeepBOM && bytes.Equal(head, utf8BOM) {
+		start += int64(len(utf8BOM))
+	}
+
+	mapped, _ := file.(*mappedFile)
+	if mapped != nil {
+		reader.mapped = mapped.data[start:]
+	}
+
+	count := min(int64(config.Concurrency), (info.Size()-start)/minChunkSize)
+	if count < 2 {
+		return nil
+	}
+
+	headerLines, _, err := countBytes(file, 0, start)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := alignChunks(file, start, info.Size(), int(count))
+	if err != nil {
+		return err
+	}
+
+	for _, c := range chunks {
+		if c.start == c.end { // A record spans the whole range.
+			continue
+		}
+
+		buffered := bufio.NewReaderSize(io.NewSectionReader(file, c.start, c.end-c.start), config.ReadBufferSizeInBytes)
+		csvReader := csv.NewReader(buffered)
+		csvReader.Comma = reader.Comma
+		csvReader.TrimLeadingSpace = reader.TrimLeadingSpace
+		csvReader.FieldsPerRecord = reader.FieldsPerRecord // The number of fields of the header, unless configured.
+		source := recordSource{Reader: csvReader, lineOffset: headerLines + c.lines, buffered: buffered}
+		if mapped != nil {
+			source.mapped = mapped.data[c.start:c.end]
+		}
+		reader.chunks = append(reader.chunks, source)
+	}
+	log.Info("Reading the file in chunks.", "chunks", len(reader.chunks), "size", info.Size())
+
+	return nil
+}
+
+// alignChunks splits the bytes of the file between start and end into count byte ranges starting at a record
+// boundary. The quotes and the line breaks of the file are first counted concurrently, one goroutine per equal range,
+// so the parity of the quotes before a range tells whether it starts within a quoted field. Then each range is moved
+// forward to the first line break outside of quotes.
+func alignChunks(file io.ReaderAt, start, end int64, count int) ([]chunk, error) {
+	bounds := make([]int64, count+1)
+	for i := range bounds {
+		bounds[i] = start + (end-start)*int64(i)/int64(count)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		lines  = make([]int, count)
+		quotes = make([]int, count)
+		errs   = make([]error, count)
+	)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lines[i], quotes[i], errs[i] = countBytes(file, bounds[i], bounds[i+1])
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chunks := make([]chunk, count)
+	chunks[0].start = start
+	linesBefore, quotesBefore := 0, 0
+	for i := 1; i < count; i++ {
+		linesBefore += lines[i-1]
+		quotesBefore += quotes[i-1]
+
+		boundary, skippedLines, err := nextRecordBoundary(file, bounds[i], end, quotesBefore%2 == 1)
+		if err != nil {
+			return nil, err
+		}
+		boundary = max(boundary, chunks[i-1].start)
+
+		chunks[i-1].end = boundary
+		chunks[i].start = boundary
+		chunks[i].lines = linesBefore + skippedLines
+	}
+	chunks[count-1].end = end
+
+	return chunks, nil
+}
+
+// countBytes returns the number of line breaks and quotes of the file between start and end.
+func countBytes(file io.ReaderAt, start, end int64) (lines, quotes int, err error) {
+	block := make([]byte, chunkScanSize)
+	for offset := start; offset < end; {
+		n, err := file.ReadAt(block[:min(int64(len(block)), end-offset)], offset)
+		lines += bytes.Count(block[:n], []byte{'\n'})
+		quotes += bytes.Count(block[:n], []byte{'"'})
+		offset += int64(n)
+		if err != nil && (err != io.EOF || offset < end) {
+			return 0, 0, err
+		}
+	}
+	return lines, quotes, nil
+}
+
+// nextRecordBoundary returns the offset following the first line break outside of quotes of the file from the given
+// offset, or end if there is none, along with the number of line breaks skipped to get there. A doubled quote in a
+// quoted field flips the state twice, so it doesn't change it.
+func nextRecordBoundary(file io.ReaderAt, offset, end int64, inQuotes bool) (int64, int, error) {
+	lines := 0
+	block := make([]byte, chunkScanSize)
+	for offset < end {
+		n, err := file.ReadAt(block[:min(int64(len(block)), end-offset)], offset)
+		for i, b := range block[:n] {
+			switch b {
+			case '"':
+				inQuotes = !inQuotes
+			case '\n':
+				lines++
+				if !inQuotes {
+					return offset + int64(i) + 1, lines, nil
+				}
+			}
+		}
+		offset += int64(n)
+		if err != nil && (err != io.EOF || offset < end) {
+			return 0, 0, err
+		}
+	}
+	return end, lines, nil
+}
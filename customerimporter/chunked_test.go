@@ -0,0 +1,160 @@
+package customerimporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestAlignChunks(t *testing.T) {
+	// Given
+	data := []byte("a,b\n" + `"x` + "\n" + `y",z` + "\n" + `"""q""",r` + "\n" + "c,d\n")
+
+	testCases := []struct {
+		name           string
+		count          int
+		expectedChunks []chunk
+	}{
+		{
+			name:           "Single chunk",
+			count:          1,
+			expectedChunks: []chunk{{start: 0, end: 26, lines: 0}},
+		},
+		{
+			name:  "Boundary after escaped quotes",
+			count: 2,
+			expectedChunks: []chunk{
+				{start: 0, end: 22, lines: 0},
+				{start: 22, end: 26, lines: 4},
+			},
+		},
+		{
+			name:  "Boundaries within quoted fields",
+			count: 4,
+			expectedChunks: []chunk{
+				{start: 0, end: 12, lines: 0},
+				{start: 12, end: 22, lines: 3},
+				{start: 22, end: 22, lines: 4},
+				{start: 22, end: 26, lines: 4},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// When
+			chunks, err := alignChunks(bytes.NewReader(data), 0, int64(len(data)), tc.count)
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if !reflect.DeepEqual(chunks, tc.expectedChunks) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedChunks, chunks)
+			}
+		})
+	}
+}
+
+func TestRunChunked(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	config.Concurrency = 4
+	config.WriteRejects = true
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "customers.csv")
+	content := writeChunkedTestFile(t, path)
+
+	results := make(map[string]*Result)
+	rejects := make(map[string][]string)
+	for _, mode := range ReaderModes {
+		// When
+		config.ReaderMode = mode
+		result, err := Run(context.Background(), log, withInput(config, path))
+		if err != nil {
+			t.Fatalf("Error running the %s import: %v", mode, err)
+		}
+		results[mode] = result
+
+		rejected, err := os.ReadFile(filepath.Join(dir, "customers.rejects.csv"))
+		if err != nil {
+			t.Fatalf("Error reading the %s rejects file: %v", mode, err)
+		}
+		rejects[mode] = strings.Split(string(rejected), "\n")
+		sort.Strings(rejects[mode]) // The rejects of the chunks are written in any order.
+	}
+
+	// Then
+	buffered, chunked := results[ReaderModeBuffered], results[ReaderModeChunked]
+	if !reflect.DeepEqual(chunked.Domains, buffered.Domains) || !reflect.DeepEqual(chunked.Stats, buffered.Stats) {
+		t.Errorf("Unexpected chunked result. Expected: %+v, Got: %+v", buffered.Stats, chunked.Stats)
+	}
+	if buffered.RowsRead != content.rows || buffered.RowsRejected != len(content.rejectedLines) {
+		t.Errorf("Unexpected stats. Expected: %d rows read, %d rejected, Got: %+v", content.rows, len(content.rejectedLines), buffered.Stats)
+	}
+	if !reflect.DeepEqual(rejects[ReaderModeChunked], rejects[ReaderModeBuffered]) {
+		t.Errorf("Unexpected chunked rejects. Expected: %v, Got: %v", len(rejects[ReaderModeBuffered]), len(rejects[ReaderModeChunked]))
+	}
+	for _, line := range content.rejectedLines {
+		if !strings.Contains(strings.Join(rejects[ReaderModeChunked], "\n"), fmt.Sprintf("line %d:", line)) {
+			t.Errorf("Unexpected rejects. Expected the row of line %d rejected", line)
+		}
+	}
+}
+
+// chunkedTestFile describes the file written by writeChunkedTestFile.
+type chunkedTestFile struct {
+	rows          int
+	rejectedLines []int
+}
+
+// writeChunkedTestFile writes a CSV file of a few MiB, so it is read in several chunks, with quoted fields holding
+// line breaks and quotes, and invalid emails at known lines.
+func writeChunkedTestFile(t *testing.T, path string) chunkedTestFile {
+	t.Helper()
+
+	var (
+		b       bytes.Buffer
+		content chunkedTestFile
+		line    = 2
+	)
+	b.WriteString("first_name,last_name,email,gender,ip_address\n")
+	for b.Len() < 4*minChunkSize {
+		switch {
+		case content.rows%1000 == 999:
+			fmt.Fprintf(&b, "Bonnie,Ortiz,bortiz%d.github.com,Female,197.54.209.129\n", content.rows)
+			content.rejectedLines = append(content.rejectedLines, line)
+			line++
+		case content.rows%7 == 0:
+			fmt.Fprintf(&b, "\"Mildred\n\"\"Milly\"\"\",\"Hernandez,\nJr.\",mhernandez%d@github%d.io,Female,38.194.51.128\n", content.rows, content.rows%13)
+			line += 3
+		default:
+			fmt.Fprintf(&b, "Dennis,Henry,dhenry%d@hubpages%d.com,Male,155.75.186.217\n", content.rows, content.rows%17)
+			line++
+		}
+		content.rows++
+	}
+
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatalf("Error writing CSV file: %v", err)
+	}
+	return content
+}
+
+// withInput returns a copy of the config reading the file at the given path.
+func withInput(config *Config, path string) *Config {
+	copied := *config
+	copied.InputCSVFilePathDefault = path
+	return &copied
+}
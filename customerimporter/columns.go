@@ -0,0 +1,125 @@
+package customerimporter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Customer field names used as keys of Config.ColumnAliases.
+const (
+	FieldFirstName = "first_name"
+	FieldLastName  = "last_name"
+	FieldEmail     = "email"
+	FieldGender    = "gender"
+	FieldIPAddress = "ip_address"
+)
+
+var (
+	// ErrEmailColumnNotFound is returned when none of the header columns can be mapped onto the customer's email.
+	ErrEmailColumnNotFound = errors.New("email column not found in the CSV header")
+
+	// ErrShortRow is returned when a record has fewer fields than needed to read the mapped columns.
+	ErrShortRow = errors.New("row has too few fields")
+)
+
+// customerFields lists the Customer field names in the order of the default (positional) CSV layout.
+var customerFields = []string{FieldFirstName, FieldLastName, FieldEmail, FieldGender, FieldIPAddress}
+
+// defaultColumnAliases are the header names recognized for each Customer field out of the box.
+var defaultColumnAliases = map[string][]string{
+	FieldFirstName: {"first_name", "firstname", "first name", "given_name"},
+	FieldLastName:  {"last_name", "lastname", "last name", "surname", "family_name"},
+	FieldEmail:     {"email", "e-mail", "email_address", "email address", "mail"},
+	FieldGender:    {"gender", "sex"},
+	FieldIPAddress: {"ip_address", "ipaddress", "ip address", "ip"},
+}
+
+// columnMapping holds the position of each Customer field in a CSV record. Fields missing from the header are set to -1.
+type columnMapping struct {
+	firstName int
+	lastName  int
+	email     int
+	gender    int
+	ipAddress int
+}
+
+// defaultColumnMapping returns the positional mapping: first_name, last_name, email, gender, ip_address.
+func defaultColumnMapping() columnMapping {
+	return columnMapping{firstName: 0, lastName: 1, email: 2, gender: 3, ipAddress: 4}
+}
+
+// width returns the minimal number of fields a record needs to hold all the mapped columns.
+func (c columnMapping) width() int {
+	width := 0
+	for _, position := range []int{c.firstName, c.lastName, c.email, c.gender, c.ipAddress} {
+		if position+1 > width {
+			width = position + 1
+		}
+	}
+
+	return width
+}
+
+// newColumnMapping maps the header column names (case-insensitive) onto the Customer fields using the given aliases
+// on top of the default ones. It fails when the email column can't be found.
+func newColumnMapping(header []string, aliases map[string][]string) (columnMapping, error) {
+	positions := make(map[string]int, len(customerFields))
+	for _, field := range customerFields {
+		positions[field] = -1
+	}
+
+	names := make(map[string]string) // Normalized column name -> Customer field name.
+	for _, field := range customerFields {
+		for _, alias := range append(defaultColumnAliases[field], aliases[field]...) {
+			names[normalizeColumnName(alias)] = field
+		}
+	}
+
+	for i, column := range header {
+		field, ok := names[normalizeColumnName(column)]
+		if !ok || positions[field] != -1 { // Unknown column or field already mapped by an earlier column.
+			continue
+		}
+		positions[field] = i
+	}
+
+	if positions[FieldEmail] == -1 {
+		accepted := append(defaultColumnAliases[FieldEmail], aliases[FieldEmail]...)
+		return columnMapping{}, fmt.Errorf("%w: header %q, accepted names %q", ErrEmailColumnNotFound, header, accepted)
+	}
+
+	return columnMapping{
+		firstName: positions[FieldFirstName],
+		lastName:  positions[FieldLastName],
+		email:     positions[FieldEmail],
+		gender:    positions[FieldGender],
+		ipAddress: positions[FieldIPAddress],
+	}, nil
+}
+
+// normalizeColumnName makes the column names comparable regardless of their case and surrounding whitespace.
+func normalizeColumnName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// columnAliasesFromEnv reads the additional column aliases from the COLUMN_ALIASES_<FIELD> comma-separated variables,
+// e.g. COLUMN_ALIASES_EMAIL=e_mail,contact_email.
+func columnAliasesFromEnv() map[string][]string {
+	aliases := make(map[string][]string)
+	for _, field := range customerFields {
+		value := os.Getenv("COLUMN_ALIASES_" + strings.ToUpper(field))
+		if value == "" {
+			continue
+		}
+
+		for _, alias := range strings.Split(value, ",") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				aliases[field] = append(aliases[field], alias)
+			}
+		}
+	}
+
+	return aliases
+}
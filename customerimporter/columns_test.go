@@ -0,0 +1,64 @@
+package customerimporter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNewColumnMapping(t *testing.T) {
+	testCases := []struct {
+		name          string
+		header        []string
+		aliases       map[string][]string
+		expectedValue columnMapping
+		expectedErr   error
+	}{
+		{
+			name:          "OK",
+			header:        []string{"first_name", "last_name", "email", "gender", "ip_address"},
+			expectedValue: columnMapping{firstName: 0, lastName: 1, email: 2, gender: 3, ipAddress: 4},
+		},
+		{
+			name:          "Case-insensitive names with surrounding whitespace",
+			header:        []string{" EMAIL ", "Gender", "First_Name"},
+			expectedValue: columnMapping{firstName: 2, lastName: -1, email: 0, gender: 1, ipAddress: -1},
+		},
+		{
+			name:          "Default alias and extra columns",
+			header:        []string{"id", "e-mail", "surname", "created_at"},
+			expectedValue: columnMapping{firstName: -1, lastName: 2, email: 1, gender: -1, ipAddress: -1},
+		},
+		{
+			name:          "Configured alias",
+			header:        []string{"name", "customer_email"},
+			aliases:       map[string][]string{FieldEmail: {"Customer_Email"}},
+			expectedValue: columnMapping{firstName: -1, lastName: -1, email: 1, gender: -1, ipAddress: -1},
+		},
+		{
+			name:          "First matching column wins",
+			header:        []string{"email", "email_address"},
+			expectedValue: columnMapping{firstName: -1, lastName: -1, email: 0, gender: -1, ipAddress: -1},
+		},
+		{
+			name:        "Missing email column",
+			header:      []string{"first_name", "last_name", "phone"},
+			expectedErr: ErrEmailColumnNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given, When
+			columns, err := newColumnMapping(tc.header, tc.aliases)
+
+			// Then
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Test %s failed. Expected error: %v, Got: %v", tc.name, tc.expectedErr, err)
+			}
+			if tc.expectedErr == nil && !reflect.DeepEqual(columns, tc.expectedValue) {
+				t.Errorf("Test %s failed. Expected: %+v, Got: %+v", tc.name, tc.expectedValue, columns)
+			}
+		})
+	}
+}
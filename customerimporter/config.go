@@ -1,58 +1,376 @@
 package customerimporter
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
-
-	log "log/slog"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
-// LoadConfig loads the configuration from the .env file.
+// Defaults and upper bounds of the config values.
+const (
+	DefaultReadBufferSizeInBytes = 64 * 1024
+	MaxConcurrency               = 4096
+	MaxReadBufferSizeInBytes     = 64 * 1024 * 1024
+	DefaultBatchSize             = 256
+	MaxBatchSize                 = 64 * 1024
+)
+
+// LoadConfig loads the configuration from the process environment and the .env file, if there is one.
+// Variables set in the process environment take precedence over the .env file. Unset variables get their defaults:
+// CONCURRENCY is the number of CPUs and READ_BUFFER_SIZE_IN_BYTES is 64KiB. An empty envFilePath skips the .env file.
+// All the invalid values are reported at once in the returned error.
 func LoadConfig(log Logger, envFilePath string) (*Config, error) {
-	err := Load(envFilePath)
+	return loadConfig(log, envFilePath, false)
+}
+
+// LoadConfigFile loads the configuration like LoadConfig, but the given config file must exist.
+func LoadConfigFile(log Logger, configFilePath string) (*Config, error) {
+	return loadConfig(log, configFilePath, true)
+}
+
+// ParseConfig loads the configuration like LoadConfig, or like LoadConfigFile if the config file is required, but only
+// reports the values which can't be parsed. The values aren't validated, so the caller can override them first, e.g.
+// with command-line flags, and then call Config.Validate.
+func ParseConfig(log Logger, envFilePath string, required bool) (*Config, error) {
+	config, err := parseConfig(log, envFilePath, required)
 	if err != nil {
-		log.Error("Loading .env file.", err)
 		return nil, err
 	}
 
-	concurrency, err := strconv.Atoi(os.Getenv("CONCURRENCY"))
-	if err != nil {
-		log.Error("Parsing CONCURRENCY variable failed.")
+	return config, nil
+}
+
+// loadConfig parses the configuration and validates it, reporting the values which can't be parsed along with the
+// invalid ones.
+func loadConfig(log Logger, envFilePath string, required bool) (*Config, error) {
+	config, err := parseConfig(log, envFilePath, required)
+	if config == nil {
+		return nil, err
 	}
 
-	if concurrency <= 0 {
-		log.Error(fmt.Sprintf("%s %d", "CONCURRENCY must be greater than 0. But was", concurrency))
+	errs := []error{err}
+	if err := config.Validate(); err != nil {
+		for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+			log.Error(err.Error())
+		}
+		errs = append(errs, err)
 	}
 
-	readBufferSizeInBytes, err := strconv.Atoi(os.Getenv("READ_BUFFER_SIZE_IN_BYTES"))
-	if err != nil {
-		log.Error("Parsing READ_BUFFER_SIZE_IN_BYTES failed.")
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
 	}
 
-	if readBufferSizeInBytes <= 0 {
-		log.Error(fmt.Sprintf("%s %d", "READ_BUFFER_SIZE_IN_BYTES must be greater than 0. But was", readBufferSizeInBytes))
+	return config, nil
+}
+
+// parseConfig parses the configuration from the process environment and the .env file, which is optional unless
+// required. It returns the config along with the errors of the values which can't be parsed, or no config if the .env
+// file can't be loaded.
+func parseConfig(log Logger, envFilePath string, required bool) (*Config, error) {
+	if envFilePath != "" {
+		err := Load(envFilePath)
+		if err != nil && (required || !errors.Is(err, fs.ErrNotExist)) {
+			log.Error("Loading .env file.", err)
+			return nil, err
+		}
+		if err != nil {
+			log.Info("No .env file found, using the process environment.", "path", envFilePath)
+		}
 	}
 
+	env := &envReader{log: log}
+
 	config := &Config{
-		Concurrency:              concurrency,
+		Concurrency:              env.Int("CONCURRENCY", runtime.NumCPU()),
 		InputCSVFilePathDefault:  os.Getenv("INPUT_CSV_FILE_PATH_DEFAULT"),
 		InputCSVFilePath0Lines:   os.Getenv("INPUT_CSV_FILE_PATH_0_LINES"),
 		InputCSVFilePath10Lines:  os.Getenv("INPUT_CSV_FILE_PATH_10_LINES"),
 		InputCSVFilePath3kLines:  os.Getenv("INPUT_CSV_FILE_PATH_3K_LINES"),
 		InputCSVFilePath10mLines: os.Getenv("INPUT_CSV_FILE_PATH_10M_LINES"),
-		ReadBufferSizeInBytes:    readBufferSizeInBytes,
+		ReadBufferSizeInBytes:    env.Int("READ_BUFFER_SIZE_IN_BYTES", DefaultReadBufferSizeInBytes),
+		BatchSize:                env.Int("BATCH_SIZE", DefaultBatchSize),
+		ReaderMode:               env.String("READER_MODE", DefaultReaderMode),
+		FastPath:                 env.Bool("FAST_PATH", false),
+		ColumnAliases:            columnAliasesFromEnv(),
+		InputEncoding:            env.String("INPUT_ENCODING", DefaultInputEncoding),
+		Delimiter:                env.Rune("CSV_DELIMITER", DefaultDelimiter),
+		SniffDelimiter:           env.Bool("CSV_SNIFF_DELIMITER", false),
+		Comment:                  env.Rune("CSV_COMMENT", 0),
+		LazyQuotes:               env.Bool("CSV_LAZY_QUOTES", false),
+		TrimLeadingSpace:         env.Bool("CSV_TRIM_LEADING_SPACE", false),
+		KeepBOM:                  !env.Bool("CSV_STRIP_BOM", true),
+		NoHeader:                 !env.Bool("CSV_HAS_HEADER", true),
+		FieldsPerRecord:          env.Int("CSV_FIELDS_PER_RECORD", 0), // Records must have as many fields as the header line.
+		WriteRejects:             env.Bool("WRITE_REJECTS", false),
+		RejectsCSVFilePath:       os.Getenv("REJECTS_CSV_FILE_PATH"),
+		EmailValidation:          env.String("EMAIL_VALIDATION", DefaultEmailValidation),
+		DomainForm:               env.String("DOMAIN_FORM", DefaultDomainForm),
+		Dedup:                    env.Bool("DEDUP", false),
+		DedupMode:                env.String("DEDUP_MODE", DefaultDedupMode),
+		DedupRules:               env.List("DEDUP_RULES", DefaultDedupRules),
+		DedupMaxInMemory:         env.Int("DEDUP_MAX_IN_MEMORY", DefaultDedupMaxInMemory),
+		DedupSpillDir:            os.Getenv("DEDUP_SPILL_DIR"),
+		HLLPrecision:             env.Int("HLL_PRECISION", DefaultHLLPrecision),
+		Aggregation:              env.String("DOMAIN_AGGREGATION", DefaultAggregation),
+		GroupBy:                  env.List("GROUP_BY", nil),
+		Filter:                   os.Getenv("FILTER"),
+		OutputFormat:             env.String("OUTPUT_FORMAT", DefaultOutputFormat),
+		OutputFilePath:           os.Getenv("OUTPUT_FILE_PATH"),
+		SortOrder:                env.String("SORT_ORDER", DefaultSortOrder),
+		Top:                      env.Int("TOP", 0),
+		Timeout:                  env.Duration("TIMEOUT", 0),
 	}
 
-	return config, nil
+	return config, errors.Join(env.errs...)
 }
 
-// LoadConfigTest loads the configuration from the .env file for tests
+// Validate checks the config values and returns all the problems found joined in one error.
+func (c *Config) Validate() error {
+	return c.validate(true)
+}
+
+// validate checks the config values, and INPUT_CSV_FILE_PATH_DEFAULT too if defaultInput is set. RunFiles and RunReader
+// don't read the default input, so a stale default doesn't fail the imports of the inputs given explicitly.
+func (c *Config) validate(defaultInput bool) error {
+	var errs []error
+
+	if c.Concurrency <= 0 {
+		errs = append(errs, fmt.Errorf("%s %d", "CONCURRENCY must be greater than 0. But was", c.Concurrency))
+	}
+
+	if c.Concurrency > MaxConcurrency {
+		errs = append(errs, fmt.Errorf("CONCURRENCY must be at most %d. But was %d", MaxConcurrency, c.Concurrency))
+	}
+
+	if c.ReadBufferSizeInBytes <= 0 {
+		errs = append(errs, fmt.Errorf("%s %d", "READ_BUFFER_SIZE_IN_BYTES must be greater than 0. But was", c.ReadBufferSizeInBytes))
+	}
+
+	if c.ReadBufferSizeInBytes > MaxReadBufferSizeInBytes {
+		errs = append(errs, fmt.Errorf("READ_BUFFER_SIZE_IN_BYTES must be at most %d. But was %d", MaxReadBufferSizeInBytes, c.ReadBufferSizeInBytes))
+	}
+
+	if c.BatchSize < 0 || c.BatchSize > MaxBatchSize {
+		errs = append(errs, fmt.Errorf("BATCH_SIZE must be between 0 (default) and %d. But was %d", MaxBatchSize, c.BatchSize))
+	}
+
+	if err := validateReaderMode(c.ReaderMode); err != nil {
+		errs = append(errs, fmt.Errorf("READER_MODE is invalid: %w", err))
+	}
+
+	if _, err := lookupEncoding(c.InputEncoding); err != nil {
+		errs = append(errs, fmt.Errorf("INPUT_ENCODING is invalid: %w", err))
+	}
+
+	errs = append(errs, validateDialect(c.Delimiter, c.Comment)...)
+
+	if c.FieldsPerRecord < -1 {
+		errs = append(errs, fmt.Errorf("%s %d", "CSV_FIELDS_PER_RECORD must be -1, 0 or greater than 0. But was", c.FieldsPerRecord))
+	}
+
+	if _, err := NewEmailValidator(c.EmailValidation); err != nil {
+		errs = append(errs, fmt.Errorf("EMAIL_VALIDATION is invalid: %w", err))
+	}
+
+	if err := validateDomainForm(c.DomainForm); err != nil {
+		errs = append(errs, fmt.Errorf("DOMAIN_FORM is invalid: %w", err))
+	}
+
+	if err := validateDedupMode(c.DedupMode); err != nil {
+		errs = append(errs, fmt.Errorf("DEDUP_MODE is invalid: %w", err))
+	}
+
+	if err := validateDedupRules(c.DedupRules); err != nil {
+		errs = append(errs, fmt.Errorf("DEDUP_RULES is invalid: %w", err))
+	}
+
+	if c.DedupMaxInMemory < 0 {
+		errs = append(errs, fmt.Errorf("%s %d", "DEDUP_MAX_IN_MEMORY must be 0 (default) or greater than 0. But was", c.DedupMaxInMemory))
+	}
+
+	if c.HLLPrecision != 0 && (c.HLLPrecision < MinHLLPrecision || c.HLLPrecision > MaxHLLPrecision) {
+		errs = append(errs, fmt.Errorf("HLL_PRECISION must be between %d and %d. But was %d", MinHLLPrecision, MaxHLLPrecision, c.HLLPrecision))
+	}
+
+	if err := validateAggregation(c.Aggregation); err != nil {
+		errs = append(errs, fmt.Errorf("DOMAIN_AGGREGATION is invalid: %w", err))
+	}
+
+	if err := validateGroupBy(c.GroupBy, c.Aggregation); err != nil {
+		errs = append(errs, fmt.Errorf("GROUP_BY is invalid: %w", err))
+	}
+
+	if _, err := compileFilter(c.Filter); err != nil {
+		errs = append(errs, fmt.Errorf("FILTER is invalid: %w", err))
+	}
+
+	if _, err := NewResultWriter(c.OutputFormat); err != nil {
+		errs = append(errs, fmt.Errorf("OUTPUT_FORMAT is invalid: %w", err))
+	}
+
+	if _, err := domainLess(c.SortOrder); err != nil {
+		errs = append(errs, fmt.Errorf("SORT_ORDER is invalid: %w", err))
+	}
+
+	if c.Top < 0 {
+		errs = append(errs, fmt.Errorf("%s %d", "TOP must be 0 (all domains) or greater than 0. But was", c.Top))
+	}
+
+	if c.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("%s %s", "TIMEOUT must be 0 (no timeout) or greater than 0. But was", c.Timeout))
+	}
+
+	if defaultInput && c.InputCSVFilePathDefault != "" && c.InputCSVFilePathDefault != StdinPath && !isGlob(c.InputCSVFilePathDefault) {
+		if err := checkReadable(c.InputCSVFilePathDefault); err != nil {
+			errs = append(errs, fmt.Errorf("INPUT_CSV_FILE_PATH_DEFAULT must be a readable file: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkReadable returns an error if the file at the given path can't be opened for reading or is a directory.
+func checkReadable(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+
+	return nil
+}
+
+// envReader reads typed values from the environment variables, collecting the parsing errors.
+type envReader struct {
+	log  Logger
+	errs []error
+}
+
+// String returns the value of the environment variable or the default value if it isn't set.
+func (r *envReader) String(name string, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// Int returns the integer value of the environment variable or the default value if it isn't set or can't be parsed.
+func (r *envReader) Int(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		r.fail(name, err)
+		return defaultValue
+	}
+
+	return number
+}
+
+// Bool returns the boolean value of the environment variable or the default value if it isn't set or can't be parsed.
+func (r *envReader) Bool(name string, defaultValue bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	boolean, err := strconv.ParseBool(value)
+	if err != nil {
+		r.fail(name, err)
+		return defaultValue
+	}
+
+	return boolean
+}
+
+// Rune returns the character value (see ParseCSVRune) of the environment variable or the default value if it isn't
+// set or can't be parsed.
+func (r *envReader) Rune(name string, defaultValue rune) rune {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	character, err := ParseCSVRune(value)
+	if err != nil {
+		r.fail(name, err)
+		return defaultValue
+	}
+
+	return character
+}
+
+// List returns the comma-separated values (see ParseList) of the environment variable or the default values if it
+// isn't set.
+func (r *envReader) List(name string, defaultValues []string) []string {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return defaultValues
+	}
+
+	return ParseList(value)
+}
+
+// ParseList parses a comma-separated list of values, e.g. DEDUP_RULES. The values are trimmed and the empty ones are
+// skipped, an empty value or "none" stands for an empty list.
+func ParseList(value string) []string {
+	values := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" && item != "none" {
+			values = append(values, item)
+		}
+	}
+
+	return values
+}
+
+// Duration returns the duration value (e.g. 30s, 5m) of the environment variable or the default value if it isn't set
+// or can't be parsed.
+func (r *envReader) Duration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		r.fail(name, err)
+		return defaultValue
+	}
+
+	return duration
+}
+
+// fail logs and collects the error of parsing the environment variable.
+func (r *envReader) fail(name string, err error) {
+	r.log.Error(fmt.Sprintf("Parsing %s failed.", name))
+	r.errs = append(r.errs, fmt.Errorf("parsing %s: %w", name, err))
+}
+
+// LoadConfigTest loads the configuration from the .env file for tests, with the 10 lines file as the default input,
+// and validates it.
 func LoadConfigTest(log Logger, envFilePath string) (*Config, error) {
-	config, err := LoadConfig(log, envFilePath)
+	config, err := ParseConfig(log, envFilePath, false)
 	if err != nil {
 		log.Error(err.Error())
 		return nil, err
@@ -66,43 +384,83 @@ func LoadConfigTest(log Logger, envFilePath string) (*Config, error) {
 		InputCSVFilePath3kLines:  config.InputCSVFilePath3kLines,
 		InputCSVFilePath10mLines: config.InputCSVFilePath10mLines,
 		ReadBufferSizeInBytes:    config.ReadBufferSizeInBytes,
+		BatchSize:                config.BatchSize,
+		ReaderMode:               config.ReaderMode,
+		FastPath:                 config.FastPath,
+		ColumnAliases:            config.ColumnAliases,
+		InputEncoding:            config.InputEncoding,
+		Delimiter:                config.Delimiter,
+		SniffDelimiter:           config.SniffDelimiter,
+		Comment:                  config.Comment,
+		LazyQuotes:               config.LazyQuotes,
+		TrimLeadingSpace:         config.TrimLeadingSpace,
+		KeepBOM:                  config.KeepBOM,
+		NoHeader:                 config.NoHeader,
+		FieldsPerRecord:          config.FieldsPerRecord,
+		WriteRejects:             config.WriteRejects,
+		RejectsCSVFilePath:       config.RejectsCSVFilePath,
+		EmailValidation:          config.EmailValidation,
+		EmailValidator:           config.EmailValidator,
+		DomainForm:               config.DomainForm,
+		Dedup:                    config.Dedup,
+		DedupMode:                config.DedupMode,
+		DedupRules:               config.DedupRules,
+		DedupMaxInMemory:         config.DedupMaxInMemory,
+		DedupSpillDir:            config.DedupSpillDir,
+		HLLPrecision:             config.HLLPrecision,
+		Aggregation:              config.Aggregation,
+		GroupBy:                  config.GroupBy,
+		Filter:                   config.Filter,
+		OutputFormat:             config.OutputFormat,
+		OutputFilePath:           config.OutputFilePath,
+		SortOrder:                config.SortOrder,
+		Top:                      config.Top,
+		Timeout:                  config.Timeout,
+	}
+
+	if err := config.Validate(); err != nil {
+		for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+			log.Error(err.Error())
+		}
+		return nil, err
 	}
 
 	return config, nil
 }
 
-// Load loads the environment variables from the .env file.
+// Load loads the environment variables from the .env file. Variables already set in the process environment are kept.
 func Load(envFile string) error { // Solution to differentiate .env file path for unit or benchmark tests; source: https://github.com/joho/godotenv/issues/126#issuecomment-1474645022
-	err := godotenv.Load(dir(envFile))
-	if err != nil {
-		log.Error(err.Error())
-		return err
-	}
-	return nil
+	return godotenv.Load(dir(envFile))
 }
 
-// dir returns the absolute path of the given environment file (envFile) in the Go module's
-// root directory. It searches for the 'go.mod' file from the current working directory upwards
-// and appends the envFile to the directory containing 'go.mod'.
-// It panics if it fails to find the 'go.mod' file.
+// dir returns the path of the given .env file (envFile). An absolute path or a file found relative to the current
+// working directory is returned as is. Otherwise it searches for the 'go.mod' file from the current working directory
+// upwards and appends the envFile to the directory containing 'go.mod', so tests and benchmarks find the module's .env
+// file. If there is no 'go.mod' (e.g. a deployed binary), the envFile is returned unchanged. The input files aren't
+// resolved this way, they are opened as given.
 func dir(envFile string) string {
+	if filepath.IsAbs(envFile) {
+		return envFile
+	}
+	if _, err := os.Stat(envFile); err == nil {
+		return envFile
+	}
+
 	currentDir, err := os.Getwd()
 	if err != nil {
-		panic(err)
+		return envFile
 	}
 
 	for {
 		goModPath := filepath.Join(currentDir, "go.mod")
 		if _, err := os.Stat(goModPath); err == nil {
-			break
+			return filepath.Join(currentDir, envFile)
 		}
 
 		parent := filepath.Dir(currentDir)
-		if parent == currentDir {
-			panic(fmt.Errorf("go.mod not found"))
+		if parent == currentDir { // Reached the root directory, there is no 'go.mod'.
+			return envFile
 		}
 		currentDir = parent
 	}
-
-	return filepath.Join(currentDir, envFile)
 }
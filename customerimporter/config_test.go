@@ -3,34 +3,49 @@ package customerimporter
 import (
 	log "log/slog"
 	"os"
+	"runtime"
 	"strings"
 	"testing"
 )
 
 func TestLoadConfigTestEnvFile(t *testing.T) {
 	testCases := []struct {
-		name    string
-		envFile string
-		logs    []string
+		name                string
+		envFile             string
+		required            bool
+		expectedConcurrency int
+		expectedErr         bool
+		logs                []string
 	}{
 		{
-			name:    "OK",
-			envFile: "data/test/.env",
+			name:                "OK",
+			envFile:             "data/test/.env",
+			expectedConcurrency: runtime.NumCPU(),
+			logs:                []string{},
+		},
+		{
+			name:                "Loading non-existent optional file",
+			envFile:             "data/test/.envNonExistentFile",
+			expectedConcurrency: runtime.NumCPU(),
 			logs: []string{
-				"ERROR: Parsing CONCURRENCY variable failed.",
-				"ERROR: CONCURRENCY must be greater than 0. But was 0",
-				"ERROR: Parsing READ_BUFFER_SIZE_IN_BYTES failed.",
-				"ERROR: READ_BUFFER_SIZE_IN_BYTES must be greater than 0. But was 0",
+				"INFO: No .env file found, using the process environment.",
 			},
 		},
 		{
-			name:    "Loading non-existent file",
-			envFile: "data/test/.envNonExistentFile",
+			name:        "Loading non-existent required file",
+			envFile:     "data/test/.envNonExistentFile",
+			required:    true,
+			expectedErr: true,
 			logs: []string{
 				"ERROR: Loading .env file.",
-				"ERROR: open",
 			},
 		},
+		{
+			name:                "Skipping the file",
+			envFile:             "",
+			expectedConcurrency: runtime.NumCPU(),
+			logs:                []string{},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -45,7 +60,23 @@ func TestLoadConfigTestEnvFile(t *testing.T) {
 			f.Close()
 
 			// When
-			_, _ = LoadConfigTest(mockLogger, tc.envFile)
+			var config *Config
+			if tc.required {
+				config, err = LoadConfigFile(mockLogger, tc.envFile)
+			} else {
+				config, err = LoadConfig(mockLogger, tc.envFile)
+			}
+
+			// Then
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("Test %s failed. Expected error: %v, Got: %v", tc.name, tc.expectedErr, err)
+			}
+			if err == nil && config.Concurrency != tc.expectedConcurrency {
+				t.Errorf("Test %s failed. Expected concurrency: %d, Got: %d", tc.name, tc.expectedConcurrency, config.Concurrency)
+			}
+			if err == nil && config.ReadBufferSizeInBytes != DefaultReadBufferSizeInBytes {
+				t.Errorf("Test %s failed. Expected read buffer size: %d, Got: %d", tc.name, DefaultReadBufferSizeInBytes, config.ReadBufferSizeInBytes)
+			}
 
 			// Check the logs.
 			for _, expectedMessage := range tc.logs {
@@ -62,15 +93,17 @@ func TestLoadConfigTestEnvFile(t *testing.T) {
 			}
 
 			os.Remove(f.Name())
+			os.Clearenv() // Don't leak the variables loaded by the test case to other tests.
 		})
 	}
 }
 
 func TestLoadConfigTestEnvVars(t *testing.T) {
 	testCases := []struct {
-		name    string
-		envVars string
-		logs    []string
+		name        string
+		envVars     string
+		expectedErr bool
+		logs        []string
 	}{
 		{
 			name: "CONCURRENCY variable valid",
@@ -91,7 +124,7 @@ INPUT_CSV_FILE_PATH_10_LINES=../data/test/customers_10_lines.csv
 INPUT_CSV_FILE_PATH_3K_LINES=../data/test/customers_3k_lines.csv
 INPUT_CSV_FILE_PATH_10M_LINES=../data/test/customers_10m_lines.csv
 READ_BUFFER_SIZE_IN_BYTES=4096`,
-			logs: []string{"ERROR: Parsing CONCURRENCY variable failed.", "ERROR: CONCURRENCY must be greater than 0. But was 0"},
+			logs: []string{},
 		},
 		{
 			name: "CONCURRENCY variable negative",
@@ -102,7 +135,8 @@ INPUT_CSV_FILE_PATH_10_LINES=../data/test/customers_10_lines.csv
 INPUT_CSV_FILE_PATH_3K_LINES=../data/test/customers_3k_lines.csv
 INPUT_CSV_FILE_PATH_10M_LINES=../data/test/customers_10m_lines.csv
 READ_BUFFER_SIZE_IN_BYTES=4096`,
-			logs: []string{"ERROR: CONCURRENCY must be greater than 0. But was -4"},
+			expectedErr: true,
+			logs:        []string{"ERROR: CONCURRENCY must be greater than 0. But was -4"},
 		},
 		{
 			name: "READ_BUFFER_SIZE_IN_BYTES variable valid",
@@ -123,7 +157,7 @@ INPUT_CSV_FILE_PATH_0_LINES=../data/test/customers_0_lines.csv
 INPUT_CSV_FILE_PATH_10_LINES=../data/test/customers_10_lines.csv
 INPUT_CSV_FILE_PATH_3K_LINES=../data/test/customers_3k_lines.csv
 INPUT_CSV_FILE_PATH_10M_LINES=../data/test/customers_10m_lines.csv`,
-			logs: []string{"Parsing READ_BUFFER_SIZE_IN_BYTES failed."},
+			logs: []string{},
 		},
 		{
 			name: "READ_BUFFER_SIZE_IN_BYTES variable negative",
@@ -134,7 +168,44 @@ INPUT_CSV_FILE_PATH_10_LINES=../data/test/customers_10_lines.csv
 INPUT_CSV_FILE_PATH_3K_LINES=../data/test/customers_3k_lines.csv
 INPUT_CSV_FILE_PATH_10M_LINES=../data/test/customers_10m_lines.csv
 READ_BUFFER_SIZE_IN_BYTES=-4096`,
-			logs: []string{"ERROR: READ_BUFFER_SIZE_IN_BYTES must be greater than 0. But was -4096"},
+			expectedErr: true,
+			logs:        []string{"ERROR: READ_BUFFER_SIZE_IN_BYTES must be greater than 0. But was -4096"},
+		},
+		{
+			name: "CONCURRENCY variable not a number",
+			envVars: `CONCURRENCY=four
+READ_BUFFER_SIZE_IN_BYTES=4096`,
+			expectedErr: true,
+			logs:        []string{"ERROR: Parsing CONCURRENCY failed."},
+		},
+		{
+			name: "CSV_LAZY_QUOTES variable not a boolean",
+			envVars: `CONCURRENCY=4
+CSV_LAZY_QUOTES=sometimes`,
+			expectedErr: true,
+			logs:        []string{"ERROR: Parsing CSV_LAZY_QUOTES failed."},
+		},
+		{
+			name: "CSV_DELIMITER variable tab",
+			envVars: `CONCURRENCY=4
+CSV_DELIMITER=tab
+CSV_COMMENT=#`,
+			logs: []string{},
+		},
+		{
+			name: "CSV_DELIMITER variable longer than a character",
+			envVars: `CONCURRENCY=4
+CSV_DELIMITER=;;`,
+			expectedErr: true,
+			logs:        []string{"ERROR: Parsing CSV_DELIMITER failed."},
+		},
+		{
+			name: "CSV_COMMENT variable same as the delimiter",
+			envVars: `CONCURRENCY=4
+CSV_DELIMITER=;
+CSV_COMMENT=;`,
+			expectedErr: true,
+			logs:        []string{"ERROR: CSV_COMMENT must differ from CSV_DELIMITER. But both were ';'"},
 		},
 	}
 
@@ -153,7 +224,12 @@ READ_BUFFER_SIZE_IN_BYTES=-4096`,
 			f.Close()
 
 			// When
-			_, _ = LoadConfigTest(mockLogger, "data/test/.env")
+			_, err = LoadConfigTest(mockLogger, "data/test/.env")
+
+			// Then
+			if (err != nil) != tc.expectedErr {
+				t.Errorf("Test %s failed. Expected error: %v, Got: %v", tc.name, tc.expectedErr, err)
+			}
 
 			// Check the logs.
 			for _, expectedMessage := range tc.logs {
@@ -170,6 +246,237 @@ READ_BUFFER_SIZE_IN_BYTES=-4096`,
 			}
 
 			os.Remove(f.Name())
+			os.Clearenv() // Don't leak the variables loaded by the test case to other tests.
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	validConfig := func() *Config {
+		return &Config{Concurrency: 4, ReadBufferSizeInBytes: 4096, InputCSVFilePathDefault: "../data/test/customers_10_lines.csv"}
+	}
+
+	testCases := []struct {
+		name           string
+		modify         func(config *Config)
+		expectedErrors []string
+	}{
+		{
+			name:           "OK",
+			modify:         func(config *Config) {},
+			expectedErrors: []string{},
+		},
+		{
+			name:           "Standard input",
+			modify:         func(config *Config) { config.InputCSVFilePathDefault = StdinPath },
+			expectedErrors: []string{},
+		},
+		{
+			name:           "CONCURRENCY zero",
+			modify:         func(config *Config) { config.Concurrency = 0 },
+			expectedErrors: []string{"CONCURRENCY must be greater than 0. But was 0"},
+		},
+		{
+			name:           "CONCURRENCY negative",
+			modify:         func(config *Config) { config.Concurrency = -4 },
+			expectedErrors: []string{"CONCURRENCY must be greater than 0. But was -4"},
+		},
+		{
+			name:           "CONCURRENCY above the upper bound",
+			modify:         func(config *Config) { config.Concurrency = MaxConcurrency + 1 },
+			expectedErrors: []string{"CONCURRENCY must be at most 4096. But was 4097"},
+		},
+		{
+			name:           "READ_BUFFER_SIZE_IN_BYTES negative",
+			modify:         func(config *Config) { config.ReadBufferSizeInBytes = -4096 },
+			expectedErrors: []string{"READ_BUFFER_SIZE_IN_BYTES must be greater than 0. But was -4096"},
+		},
+		{
+			name:           "READ_BUFFER_SIZE_IN_BYTES above the upper bound",
+			modify:         func(config *Config) { config.ReadBufferSizeInBytes = MaxReadBufferSizeInBytes + 1 },
+			expectedErrors: []string{"READ_BUFFER_SIZE_IN_BYTES must be at most 67108864. But was 67108865"},
+		},
+		{
+			name:           "CSV_FIELDS_PER_RECORD below -1",
+			modify:         func(config *Config) { config.FieldsPerRecord = -2 },
+			expectedErrors: []string{"CSV_FIELDS_PER_RECORD must be -1, 0 or greater than 0. But was -2"},
+		},
+		{
+			name:           "INPUT_ENCODING unknown",
+			modify:         func(config *Config) { config.InputEncoding = "klingon" },
+			expectedErrors: []string{"INPUT_ENCODING is invalid: unknown encoding \"klingon\""},
+		},
+		{
+			name:           "EMAIL_VALIDATION unknown",
+			modify:         func(config *Config) { config.EmailValidation = "rfc822" },
+			expectedErrors: []string{"EMAIL_VALIDATION is invalid: unknown email validation \"rfc822\""},
+		},
+		{
+			name:           "DEDUP_RULES unknown",
+			modify:         func(config *Config) { config.DedupRules = []string{DedupRuleGmail, "yahoo"} },
+			expectedErrors: []string{"DEDUP_RULES is invalid: unknown dedup rule \"yahoo\""},
+		},
+		{
+			name:           "DEDUP_MODE unknown",
+			modify:         func(config *Config) { config.DedupMode = "bloom" },
+			expectedErrors: []string{"DEDUP_MODE is invalid: unknown dedup mode \"bloom\""},
+		},
+		{
+			name:           "HLL_PRECISION out of range",
+			modify:         func(config *Config) { config.HLLPrecision = 19 },
+			expectedErrors: []string{"HLL_PRECISION must be between 4 and 18. But was 19"},
+		},
+		{
+			name:           "DEDUP_MAX_IN_MEMORY negative",
+			modify:         func(config *Config) { config.DedupMaxInMemory = -1 },
+			expectedErrors: []string{"DEDUP_MAX_IN_MEMORY must be 0 (default) or greater than 0. But was -1"},
+		},
+		{
+			name:           "BATCH_SIZE too large",
+			modify:         func(config *Config) { config.BatchSize = MaxBatchSize + 1 },
+			expectedErrors: []string{"BATCH_SIZE must be between 0 (default) and 65536. But was 65537"},
+		},
+		{
+			name:           "READER_MODE unknown",
+			modify:         func(config *Config) { config.ReaderMode = "async" },
+			expectedErrors: []string{"READER_MODE is invalid: unknown reader mode \"async\""},
+		},
+		{
+			name:           "FILTER invalid",
+			modify:         func(config *Config) { config.Filter = "gender = Female" },
+			expectedErrors: []string{"FILTER is invalid: unknown operator at offset 7"},
+		},
+		{
+			name:           "GROUP_BY unknown",
+			modify:         func(config *Config) { config.GroupBy = []string{GroupKeyDomain, "age"} },
+			expectedErrors: []string{"GROUP_BY is invalid: unknown group key \"age\""},
+		},
+		{
+			name:           "DOMAIN_AGGREGATION unknown",
+			modify:         func(config *Config) { config.Aggregation = "organisation" },
+			expectedErrors: []string{"DOMAIN_AGGREGATION is invalid: unknown aggregation \"organisation\""},
+		},
+		{
+			name:           "CSV_DELIMITER quote",
+			modify:         func(config *Config) { config.Delimiter = '"' },
+			expectedErrors: []string{"CSV_DELIMITER must not be a quote, a line break or an invalid character. But was '\"'"},
+		},
+		{
+			name:           "CSV_COMMENT line break",
+			modify:         func(config *Config) { config.Comment = '\n' },
+			expectedErrors: []string{"CSV_COMMENT must not be a quote, a line break or an invalid character. But was '\\n'"},
+		},
+		{
+			name:           "CSV_COMMENT same as the default delimiter",
+			modify:         func(config *Config) { config.Comment = ',' },
+			expectedErrors: []string{"CSV_COMMENT must differ from CSV_DELIMITER. But both were ','"},
+		},
+		{
+			name:           "Input file doesn't exist",
+			modify:         func(config *Config) { config.InputCSVFilePathDefault = "../data/test/customers_non_existent.csv" },
+			expectedErrors: []string{"INPUT_CSV_FILE_PATH_DEFAULT must be a readable file", "no such file or directory"},
+		},
+		{
+			name:           "Input path is a directory",
+			modify:         func(config *Config) { config.InputCSVFilePathDefault = "../data/test" },
+			expectedErrors: []string{"INPUT_CSV_FILE_PATH_DEFAULT must be a readable file", "is a directory"},
+		},
+		{
+			name: "Multiple problems",
+			modify: func(config *Config) {
+				config.Concurrency = 0
+				config.ReadBufferSizeInBytes = 0
+				config.InputCSVFilePathDefault = "../data/test"
+			},
+			expectedErrors: []string{
+				"CONCURRENCY must be greater than 0. But was 0",
+				"READ_BUFFER_SIZE_IN_BYTES must be greater than 0. But was 0",
+				"INPUT_CSV_FILE_PATH_DEFAULT must be a readable file",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			config := validConfig()
+			tc.modify(config)
+
+			// When
+			err := config.Validate()
+
+			// Then
+			if (err != nil) != (len(tc.expectedErrors) > 0) {
+				t.Fatalf("Test %s failed. Expected errors: %v, Got: %v", tc.name, tc.expectedErrors, err)
+			}
+			for _, expectedError := range tc.expectedErrors {
+				if !strings.Contains(err.Error(), expectedError) {
+					t.Errorf("Test %s failed. Expected error: \"%s\", Got: %v", tc.name, expectedError, err)
+				}
+			}
 		})
 	}
 }
+
+func TestLoadConfigAggregatesErrors(t *testing.T) {
+	// Given
+	mockLogger := NewMockLogger()
+	os.Clearenv()
+	defer os.Clearenv()
+	os.Setenv("CONCURRENCY", "four")
+	os.Setenv("READ_BUFFER_SIZE_IN_BYTES", "-1")
+	os.Setenv("CSV_LAZY_QUOTES", "sometimes")
+
+	// When
+	config, err := LoadConfig(mockLogger, "")
+
+	// Then
+	if config != nil {
+		t.Errorf("Unexpected config. Expected: %v, Got: %v", nil, config)
+	}
+
+	expectedErrors := []string{
+		"parsing CONCURRENCY",
+		"READ_BUFFER_SIZE_IN_BYTES must be greater than 0. But was -1",
+		"parsing CSV_LAZY_QUOTES",
+	}
+	for _, expectedError := range expectedErrors {
+		if err == nil || !strings.Contains(err.Error(), expectedError) {
+			t.Errorf("Expected error: \"%s\", Got: %v", expectedError, err)
+		}
+	}
+}
+
+func TestParseConfigDoesNotValidate(t *testing.T) {
+	// Given
+	mockLogger := NewMockLogger()
+	os.Clearenv()
+	defer os.Clearenv()
+	os.Setenv("CONCURRENCY", "0")
+	os.Setenv("INPUT_CSV_FILE_PATH_DEFAULT", "../data/test/customers_10_lines.csv")
+
+	// When
+	_, loadErr := LoadConfig(mockLogger, "")
+	config, err := ParseConfig(mockLogger, "", false)
+
+	// Then
+	if loadErr == nil {
+		t.Errorf("Unexpected error. Expected: %v, Got: %v", "CONCURRENCY must be greater than 0. But was 0", loadErr)
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error. Expected: %v, Got: %v", nil, err)
+	}
+	if config.Concurrency != 0 {
+		t.Errorf("Unexpected concurrency. Expected: %d, Got: %d", 0, config.Concurrency)
+	}
+
+	// The caller overrides the invalid value before validating the config, like the command-line flags do.
+	expectedError := "CONCURRENCY must be greater than 0. But was 0"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), expectedError) {
+		t.Errorf("Expected error: \"%s\", Got: %v", expectedError, err)
+	}
+	config.Concurrency = 2
+	if err := config.Validate(); err != nil {
+		t.Errorf("Unexpected error. Expected: %v, Got: %v", nil, err)
+	}
+}
@@ -7,79 +7,341 @@ package customerimporter
 
 import (
 	"bufio"
+	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"regexp"
-	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Run opens CSV file, prepare a CSV file reader, process email domains and count the occurences and sort email domains by name.
-func Run(log Logger, config *Config) error {
-	file, err := os.Open(config.InputCSVFilePathDefault)
+// It returns the sorted email domains with their occurrences along with the import totals.
+// When the context is cancelled or Config.Timeout elapses, reading stops and Run returns the partial result of the rows
+// read so far along with the context's error.
+func Run(ctx context.Context, log Logger, config *Config) (*Result, error) {
+	err := config.Validate()
+	if config.InputCSVFilePathDefault == "" {
+		err = errors.Join(err, errors.New("INPUT_CSV_FILE_PATH_DEFAULT must be set"))
+	}
 	if err != nil {
-		log.Warn("Error opening CSV file.", err)
-		return err
+		log.Warn("Invalid config.", err)
+		return nil, err
+	}
+
+	return runFiles(ctx, log, config, config.InputCSVFilePathDefault)
+}
+
+// RunReader imports the CSV data read from r like Run does for a file. Rejected rows are written only to
+// REJECTS_CSV_FILE_PATH, as there is no file to write them alongside.
+func RunReader(ctx context.Context, log Logger, config *Config, r io.Reader) (*Result, error) {
+	start := time.Now()
+
+	if err := config.validate(false); err != nil {
+		log.Warn("Invalid config.", err)
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, config)
+	defer cancel()
+
+	unique := newUniqueCounter(config)
+	if unique != nil {
+		defer unique.Close()
+	}
+
+	emailDomains, stats, err := importReader(ctx, log, config, r, config.RejectsCSVFilePath, unique)
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+
+	result, resultErr := newResult(emailDomains, stats, config)
+	if resultErr != nil {
+		return nil, resultErr
+	}
+	if resultErr := result.addUniqueCounts(unique, config); resultErr != nil {
+		return nil, resultErr
+	}
+	result.Duration = time.Since(start)
+
+	return result, err // A cancelled import returns the partial result along with the context's error.
+}
+
+// RunFiles imports the CSV files at the given paths, one after another, and merges their domain counts into one Result.
+// The paths may be glob patterns (e.g. data/customers_*.csv) and "-" stands for the standard input. The subtotals of
+// each file are available in Result.Files. Config.Timeout applies to all the files together.
+func RunFiles(ctx context.Context, log Logger, config *Config, paths ...string) (*Result, error) {
+	if err := config.validate(false); err != nil {
+		log.Warn("Invalid config.", err)
+		return nil, err
 	}
-	defer file.Close()
 
-	reader, err := createCSVfileReader(log, config, file)
+	return runFiles(ctx, log, config, paths...)
+}
+
+// runFiles imports the CSV files at the given paths like RunFiles, once the config is validated.
+func runFiles(ctx context.Context, log Logger, config *Config, paths ...string) (*Result, error) {
+	start := time.Now()
+
+	inputs, err := expandInputs(config, paths)
+	if err != nil {
+		log.Warn("Error listing CSV files.", err)
+		return nil, err
+	}
+
+	if len(inputs) > 1 && config.RejectsCSVFilePath != "" {
+		return nil, fmt.Errorf("REJECTS_CSV_FILE_PATH can't be used with %d input files, use WRITE_REJECTS to write the rejects alongside each of them", len(inputs))
+	}
+
+	ctx, cancel := withTimeout(ctx, config)
+	defer cancel()
+
+	var (
+		emailDomains = make(map[string]int)
+		stats        Stats
+		files        = make([]FileResult, 0, len(inputs))
+		unique       = newUniqueCounter(config) // Shared by the files, so customers found in several files count once.
+	)
+	if unique != nil {
+		defer unique.Close()
+	}
+
+	for _, input := range inputs {
+		fileStart := time.Now()
+
+		fileDomains, fileStats, err := importFile(ctx, log, config, input, unique)
+		if err != nil && ctx.Err() == nil {
+			return nil, err
+		}
+
+		for domain, count := range fileDomains {
+			emailDomains[domain] += count
+		}
+		stats.add(fileStats)
+
+		fileResult, resultErr := newResult(fileDomains, fileStats, config)
+		if resultErr != nil {
+			return nil, resultErr
+		}
+		files = append(files, FileResult{Path: input, Result: *fileResult})
+		files[len(files)-1].Duration = time.Since(fileStart)
+
+		if err != nil { // Cancelled or timed out, the files left aren't imported.
+			break
+		}
+	}
+
+	result, err := newResult(emailDomains, stats, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := result.addUniqueCounts(unique, config); err != nil {
+		return nil, err
+	}
+	result.Files = files
+	result.Duration = time.Since(start)
+
+	return result, ctx.Err() // A cancelled import returns the partial result along with the context's error.
+}
+
+// withTimeout returns a context cancelled after Config.Timeout, if there is one.
+func withTimeout(ctx context.Context, config *Config) (context.Context, context.CancelFunc) {
+	if config.Timeout > 0 {
+		return context.WithTimeout(ctx, config.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// newResult builds a Result out of the email domains map, aggregating and ordering the domains as configured. When
+// the customers are grouped by other keys, the map holds the composite keys instead and they are ordered alike.
+func newResult(emailDomains map[string]int, stats Stats, config *Config) (*Result, error) {
+	if grouped(config.GroupBy) {
+		groups, distinctGroups, err := groupCounts(emailDomains, config)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Domains: groups, DistinctDomains: distinctGroups, Stats: stats, GroupBy: config.GroupBy}, nil
+	}
+
+	domains, distinctDomains, err := aggregateDomains(emailDomains, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Domains:         domains,
+		DistinctDomains: distinctDomains,
+		Stats:           stats,
+	}, nil
+}
+
+// addUniqueCounts sets the unique customers of the result's domains counted by the unique counter, if any.
+func (r *Result) addUniqueCounts(unique uniqueCounter, config *Config) error {
+	if unique == nil {
+		return nil
+	}
+
+	uniqueCounts, total, err := unique.Counts()
 	if err != nil {
 		return err
 	}
 
-	emailDomains := processEmailDomainsConcurrently(log, config, reader)
+	r.Deduplicated = true
+	r.UniqueCustomers = total
+	if config.DedupMode == DedupModeHLL {
+		r.UniqueError = hllStdError(hllPrecision(config))
+	}
+
+	if grouped(config.GroupBy) { // The unique customers are counted by composite key already.
+		for i := range r.Domains {
+			r.Domains[i].Unique = uniqueCounts[strings.Join(r.Domains[i].Key, groupKeySeparator)]
+		}
+		return nil
+	}
 
-	sortedDomains := sortEmailDomains(emailDomains)
-	for _, domain := range sortedDomains {
-		log.Info("Sorted domain.", "domain_name", domain, "occurrences", emailDomains[domain])
+	uniqueDomains := aggregateCounts(uniqueCounts, config)
+	uniqueSubdomains := aggregateCounts(uniqueCounts, &Config{DomainForm: config.DomainForm})
+	for i := range r.Domains {
+		r.Domains[i].Unique = uniqueDomains[r.Domains[i].Domain]
+		for j := range r.Domains[i].Subdomains {
+			r.Domains[i].Subdomains[j].Unique = uniqueSubdomains[r.Domains[i].Subdomains[j].Domain]
+		}
 	}
 
 	return nil
 }
 
-// processEmailDomainsConcurrently processes email domains concurrently using worker goroutines.
-// It takes a logger, configuration, and a CSV reader as input, and returns a map of email domains with their occurrences.
-// The function utilizes goroutines and channels to achieve concurrent processing.
-func processEmailDomainsConcurrently(log Logger, config *Config, reader *csv.Reader) map[string]int {
+// processEmailDomainsConcurrently counts the valid rows of the reader per email domain (or composite key, see
+// Config.GroupBy) with Config.Concurrency workers, along with the rows read, rejected and filtered out. The rejected
+// rows are written to rejects and the canonical emails added to unique, when given. When the context is done, the
+// partial counts are returned along with its error.
+func processEmailDomainsConcurrently(ctx context.Context, log Logger, config *Config, reader *csvFileReader, rejects *rejectsWriter, unique uniqueCounter) (map[string]int, Stats, error) {
 	var (
 		emailDomains = make(map[string]int)
-		emailRegex   = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-		domainRegex  = regexp.MustCompile(`^[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+		stats        Stats
+		sources      = reader.sources()
+		readStats    = make([]Stats, len(sources)) // Written by each feeder at its own index, read once all the workers are done.
+		readErrs     = make([]error, len(sources)) // Written by each feeder at its own index, read once all the workers are done.
+		feeders      sync.WaitGroup
+		workers      []workerTotals // Written by each worker at its own index, read once all the workers are done.
+		rejectsErr   error
+		uniqueErr    error
 		wg           sync.WaitGroup
 		tasks        = make(chan Task, config.Concurrency)
-		results      = make(chan DomainCounter, config.Concurrency)
-		errors       = make(chan error, config.Concurrency)
+		results      = make(chan []DomainCounter, config.Concurrency)
+		errors       = make(chan *RowError, config.Concurrency)
 	)
 
+	validator, err := emailValidator(config)
+	if err != nil {
+		return nil, Stats{}, err
+	}
+
+	filter, err := compileFilter(config.Filter)
+	if err != nil {
+		return nil, Stats{}, err
+	}
+
+	grouper, err := newGrouper(config, reader.header)
+	if err != nil {
+		log.Warn("Resolving the group keys failed.", err)
+		return nil, Stats{}, err
+	}
+
+	batchSize := config.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	fastPath := fastPathSupported(log, config, reader)
+	comma := []byte(string(reader.Comma))
+
 	// Start worker goroutines.
+	workers = make([]workerTotals, config.Concurrency)
 	for i := 0; i < config.Concurrency; i++ {
 		wg.Add(1)
-		go func() {
+		go func(totals *workerTotals) {
 			defer wg.Done()
 
-			for task := range tasks {
-				customer := parseCustomer(task.record)
-				domain := extractDomain(customer.Email)
+			totals.counts = make(map[string]int)
+			fast := newFastEmails(validator)
+			var emails []DomainCounter // Canonical emails of the batch, when deduplicating customers.
 
-				// Validate email.
-				if !emailRegex.MatchString(customer.Email) {
-					errors <- fmt.Errorf("invalid email format: %s", customer.Email)
-					continue
+			count := func(record []string, line int) {
+				customer, err := parseCustomer(record, reader.columns)
+				if err != nil {
+					errors <- &RowError{Line: line, Value: err.Error(), Reason: ReasonShortRow, record: record, err: err}
+					return
+				}
+				email := strings.TrimSpace(customer.Email)
+				localPart, domain, ok := splitEmail(email)
+				if !ok {
+					errors <- &RowError{Line: line, Field: FieldEmail, Value: customer.Email, Reason: ReasonInvalidEmail, record: record}
+					return
 				}
 
-				// Validate domain.
-				if domain == "" || !domainRegex.MatchString(domain) {
-					errors <- fmt.Errorf("invalid domain: %s", domain)
-					continue
+				// Normalize the domain, so its different spellings are counted together.
+				domain, err = normalizeDomain(domain)
+				if err != nil {
+					errors <- &RowError{Line: line, Field: FieldEmail, Value: customer.Email, Reason: ReasonInvalidDomain, record: record, err: err}
+					return
 				}
 
-				results <- DomainCounter{domain, 1}
+				// Validate email, with the normalized domain.
+				if err := validator.Validate(localPart, domain); err != nil {
+					reason, value := rejectReason(err), customer.Email
+					if reason == ReasonInvalidDomain {
+						value = domain
+					}
+					errors <- &RowError{Line: line, Field: FieldEmail, Value: value, Reason: reason, record: record, err: err}
+					return
+				}
+
+				if filter != nil && !filter.match(filterRow{customer: customer, domain: domain}) {
+					totals.filtered++
+					return
+				}
+
+				key := domain
+				if grouper != nil {
+					key = grouper.key(record, customer, domain)
+				}
+				totals.counts[key]++
+
+				if unique != nil {
+					emails = append(emails, DomainCounter{domain: key, email: canonicalEmail(localPart, domain, config.DedupRules)})
+				}
 			}
-		}()
+
+			for task := range tasks {
+				emails = nil
+				for i, record := range task.records {
+					count(record, task.lines[i])
+				}
+
+				if task.fast != nil {
+					for _, row := range task.fast.rows {
+						localPart, domain, ok := fast.split(task.fast, row)
+						if !ok { // Handled as a record, so it is rejected for the same reason.
+							count(task.fast.record(row, comma, reader.TrimLeadingSpace), row.line)
+							continue
+						}
+
+						totals.counts[domain]++
+						if unique != nil {
+							emails = append(emails, DomainCounter{domain: domain, email: canonicalEmail(localPart, domain, config.DedupRules)})
+						}
+					}
+					putFastBatch(task.fast)
+				}
+
+				if len(emails) > 0 {
+					results <- emails
+				}
+			}
+		}(&workers[i])
 	}
 
 	// Start a goroutine to close the results and errors channels when all workers are done.
@@ -89,86 +351,256 @@ func processEmailDomainsConcurrently(log Logger, config *Config, reader *csv.Rea
 		close(errors)
 	}()
 
-	// Start a goroutine to feed tasks to the workers.
-	go func() {
-		for {
-			record, err := reader.Read()
-			if err != nil {
-				if err == io.EOF {
-					break
+	// Start a goroutine per record source (one, unless the file is read in chunks) to feed batches of records to the
+	// workers, and one to close the tasks channel once all of them are done.
+	for i, source := range sources {
+		feeders.Add(1)
+		go func(source recordSource, readStats *Stats, readErr *error) {
+			defer feeders.Done()
+
+			var scanner *fastScanner
+			if fastPath {
+				scanner = newFastScanner(source, reader)
+			}
+
+			task := newTask(batchSize, scanner != nil)
+			send := func() {
+				size := task.size() // The worker recycles the fast batch once done with it.
+				select {
+				case tasks <- task:
+					readStats.RowsRead += size
+				case <-ctx.Done():
 				}
-				log.Warn("The reader failed while reading the file.", err)
-				continue
+				task = newTask(batchSize, scanner != nil)
 			}
 
-			tasks <- Task{record}
-		}
+			for ctx.Err() == nil {
+				var (
+					record []string
+					line   int
+					err    error
+				)
+				if scanner != nil {
+					record, line, err = scanner.scan(&task)
+				} else if record, err = source.Read(); err == nil {
+					line, _ = source.FieldPos(0)
+				}
+				if err != nil {
+					if err == io.EOF {
+						break
+					}
 
+					// Malformed rows (e.g. wrong number of fields, bare quotes) are rejected, the reader moves on to the next row.
+					rowErr, ok := newParseRowError(err, record)
+					if !ok {
+						log.Warn("The reader failed while reading the file.", err)
+						*readErr = err
+						break
+					}
+					rowErr.Line += source.lineOffset
+
+					select {
+					case errors <- rowErr:
+						readStats.RowsRead++
+					case <-ctx.Done():
+					}
+					continue
+				}
+
+				if record != nil { // Otherwise the fast scanner added the row to the fast batch.
+					task.records = append(task.records, record)
+					task.lines = append(task.lines, source.lineOffset+line)
+				}
+				if task.size() == batchSize {
+					send()
+				}
+			}
+
+			if task.size() > 0 && ctx.Err() == nil { // The last, partial batch.
+				send()
+			}
+		}(source, &readStats[i], &readErrs[i])
+	}
+	go func() {
+		feeders.Wait()
 		close(tasks)
 	}()
 
-	// Collect results and handle errors from workers.
-	for {
+	// Collect the emails to deduplicate and handle errors from workers until both channels are closed and drained.
+	for results != nil || errors != nil {
 		select {
-		case result, ok := <-results:
+		case emails, ok := <-results:
 			if !ok { // Results channel closed, no more results to process.
-				return emailDomains
+				results = nil
+				continue
+			}
+			for _, result := range emails {
+				if unique != nil && uniqueErr == nil {
+					uniqueErr = unique.Add(result.domain, result.email)
+				}
 			}
-			emailDomains[result.domain] += result.counter
 
-		case err, ok := <-errors:
+		case rowErr, ok := <-errors:
 			if !ok { // Errors channel closed, no more errors to process.
-				return emailDomains
+				errors = nil
+				continue
+			}
+			log.Warn("Row rejected.", "line", rowErr.Line, "reason", rowErr.Reason, "field", rowErr.Field, "value", rowErr.Value)
+
+			stats.RowsRejected++
+			if stats.ErrorsByReason == nil {
+				stats.ErrorsByReason = make(map[string]int)
 			}
-			log.Warn("Error processing email domain.", err)
+			stats.ErrorsByReason[rowErr.Reason]++
+
+			if rejects != nil && rejectsErr == nil {
+				rejectsErr = rejects.Write(rowErr)
+			}
+		}
+	}
+
+	// Merge the counts of the workers, all of them are done.
+	for _, totals := range workers {
+		for key, count := range totals.counts {
+			emailDomains[key] += count
 		}
+		stats.RowsFiltered += totals.filtered
 	}
+	for _, sourceStats := range readStats {
+		stats.RowsRead += sourceStats.RowsRead
+	}
+
+	if rejects != nil && rejectsErr == nil {
+		rejectsErr = rejects.Flush()
+	}
+
+	if err := ctx.Err(); err != nil {
+		log.Warn("Processing email domains stopped.", err)
+		return emailDomains, stats, err
+	}
+	for _, readErr := range readErrs {
+		if readErr != nil {
+			return emailDomains, stats, readErr
+		}
+	}
+	if rejectsErr != nil {
+		log.Warn("Writing the rejects file failed.", rejectsErr)
+		return emailDomains, stats, rejectsErr
+	}
+	if uniqueErr != nil {
+		log.Warn("Deduplicating the customers failed.", uniqueErr)
+		return emailDomains, stats, uniqueErr
+	}
+
+	return emailDomains, stats, nil
 }
 
-// createCSVfileReader sets and use buffered reader from bufio package. It returns a csvReader ready to be used for CSV file processing.
-func createCSVfileReader(log Logger, config *Config, file *os.File) (*csv.Reader, error) {
+// createCSVfileReader sets and use buffered reader from bufio package. It returns a csvFileReader ready to be used for CSV file processing.
+// Gzip, bzip2 and zstd compressed input is detected by its magic bytes and decompressed transparently; the returned
+// reader must be closed to release the decompressor. Input in other encodings than UTF-8 is decoded. The CSV dialect (delimiter, comment lines, quotes, BOM) is set
+// from the config. The header line, if there is one, is consumed to resolve the position of the customer's fields.
+func createCSVfileReader(log Logger, config *Config, file io.Reader) (*csvFileReader, error) {
 	reader := bufio.NewReaderSize(file, config.ReadBufferSizeInBytes)
-	csvReader := csv.NewReader(reader)
 
-	// Skip the header line.
-	_, err := csvReader.Read()
-	if err != nil && err != io.EOF {
-		log.Warn("Skipping the first line in the file failed.", err)
+	compression, err := detectCompression(reader)
+	if err != nil {
+		log.Warn("Reading the file failed.", err)
 		return nil, err
 	}
 
-	return csvReader, nil
-}
+	decompressed, closer, err := decompress(reader, compression)
+	if err != nil {
+		log.Warn("Opening the compressed file failed.", err)
+		return nil, err
+	}
+	if compression != CompressionNone { // Buffer the decompressed data, the raw data is already buffered.
+		reader = bufio.NewReaderSize(decompressed, config.ReadBufferSizeInBytes)
+	}
 
-// parseCustomer parses record input to Customer struct for better visibility and maintability of the code.
-func parseCustomer(record []string) *Customer {
-	return &Customer{
-		FirstName: record[0],
-		LastName:  record[1],
-		Email:     record[2],
-		Gender:    record[3],
-		IPAddress: record[4],
+	reader, err = decodeInput(reader, config.InputEncoding, config.ReadBufferSizeInBytes)
+	if err != nil {
+		closer.Close()
+		log.Warn("Decoding the file failed.", err)
+		return nil, err
 	}
-}
 
-// sortEmailDomains sorts map of email domains input.
-func sortEmailDomains(emailDomains map[string]int) []string {
-	var sortedDomains []string
-	for domain := range emailDomains {
-		sortedDomains = append(sortedDomains, domain)
+	if !config.KeepBOM {
+		if err := stripBOM(reader); err != nil {
+			closer.Close()
+			log.Warn("Reading the file failed.", err)
+			return nil, err
+		}
 	}
 
-	sort.Strings(sortedDomains)
+	delimiter := delimiterOrDefault(config.Delimiter)
+	if config.SniffDelimiter {
+		if sniffed, ok := sniffDelimiter(reader, config.Comment); ok {
+			delimiter = sniffed
+		}
+		log.Info("CSV delimiter sniffed.", "delimiter", string(delimiter))
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.Comma = delimiter
+	csvReader.Comment = config.Comment
+	csvReader.LazyQuotes = config.LazyQuotes
+	csvReader.TrimLeadingSpace = config.TrimLeadingSpace
+	csvReader.FieldsPerRecord = config.FieldsPerRecord
+
+	fileReader := &csvFileReader{Reader: csvReader, columns: defaultColumnMapping(), header: customerFields, compression: compression, closer: closer}
+	if config.NoHeader { // The records hold the customer's fields in the default order.
+		fileReader.buffered = reader
+		return fileReader, nil
+	}
+
+	header, err := csvReader.Read()
+	if err == io.EOF { // Empty file, there are no records to map.
+		return fileReader, nil
+	}
+	if err != nil {
+		closer.Close()
+		log.Warn("Reading the header line in the file failed.", err)
+		return nil, err
+	}
 
-	return sortedDomains
+	columns, err := newColumnMapping(header, config.ColumnAliases)
+	if err != nil {
+		closer.Close()
+		log.Warn("Mapping the header columns failed.", err)
+		return nil, err
+	}
+	fileReader.columns, fileReader.header = columns, header
+
+	// The csv.Reader reads from the buffered reader itself, rather than buffering it again, when its buffer is as large
+	// as the csv.Reader's one. The header ends on the line its last field starts on, unless that field holds line breaks.
+	if reader.Size() >= csvReaderBufferSize {
+		fileReader.buffered = reader
+	}
+	line, _ := csvReader.FieldPos(len(header) - 1)
+	fileReader.headerLines = line + strings.Count(header[len(header)-1], "\n")
+
+	return fileReader, nil
 }
 
-// extractDomain extracts the domain from the email input. Returns empty string if the email is invalid.
-func extractDomain(email string) string {
-	parts := strings.Split(email, "@")
-	if len(parts) != 2 { // Invalid email.
-		return ""
+// parseCustomer parses record input to Customer struct for better visibility and maintability of the code.
+// Fields missing from the header are left empty. It returns an error if the record is too short to hold the mapped columns.
+func parseCustomer(record []string, columns columnMapping) (*Customer, error) {
+	if width := columns.width(); len(record) < width {
+		return nil, fmt.Errorf("%w: got %d, expected at least %d", ErrShortRow, len(record), width)
 	}
 
-	return parts[1]
+	field := func(position int) string {
+		if position < 0 {
+			return ""
+		}
+		return record[position]
+	}
+
+	return &Customer{
+		FirstName: field(columns.firstName),
+		LastName:  field(columns.lastName),
+		Email:     field(columns.email),
+		Gender:    field(columns.gender),
+		IPAddress: field(columns.ipAddress),
+	}, nil
 }
@@ -1,14 +1,17 @@
 package customerimporter
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
 func BenchmarkProcessEmailDomainsConcurrently(b *testing.B) {
 	log := NewMockLogger()
-	config, err := LoadConfig(log, "./.env")
+	config, err := LoadConfigTest(log, "./.env")
 	if err != nil {
 		b.Fatalf("Error loading config: %v", err)
 	}
@@ -39,7 +42,7 @@ func BenchmarkProcessEmailDomainsConcurrently(b *testing.B) {
 								b.Fatal(err)
 							}
 
-							_ = processEmailDomainsConcurrently(log, config, reader)
+							_, _, err = processEmailDomainsConcurrently(context.Background(), log, config, reader, nil, nil)
 							if err != nil {
 								b.Fatal(err)
 							}
@@ -50,3 +53,261 @@ func BenchmarkProcessEmailDomainsConcurrently(b *testing.B) {
 		})
 	}
 }
+
+func BenchmarkSortDomainCounts(b *testing.B) {
+	emailDomains := make(map[string]int)
+	for i := 0; i < 1_000_000; i++ {
+		emailDomains[fmt.Sprintf("domain%d.com", i)] = i % 1000
+	}
+
+	for _, top := range []int{0, 20} {
+		b.Run(fmt.Sprintf("Top: %d", top), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := sortDomainCounts(emailDomains, SortCountDesc, top); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCompressedInput(b *testing.B) {
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		b.Fatalf("Error loading config: %v", err)
+	}
+
+	for _, extension := range []string{"", ".gz", ".bz2", ".zst"} {
+		filePath := config.InputCSVFilePath3kLines + extension
+
+		b.Run(fmt.Sprintf("File: %s", filePath), func(b *testing.B) {
+			info, err := os.Stat(filePath)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(info.Size()) // Throughput of the file as stored, compressed or not.
+
+			for i := 0; i < b.N; i++ {
+				file, err := os.Open(filePath)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				reader, err := createCSVfileReader(log, config, file)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				_, _, err = processEmailDomainsConcurrently(context.Background(), log, config, reader, nil, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				reader.Close()
+				file.Close()
+			}
+		})
+	}
+}
+
+func BenchmarkDedup(b *testing.B) {
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		b.Fatalf("Error loading config: %v", err)
+	}
+	config.Dedup = true
+
+	filePaths := []string{config.InputCSVFilePath3kLines}
+	if !testing.Short() {
+		filePaths = append(filePaths, generateCustomersFile(b, 10_000_000))
+	}
+
+	for _, filePath := range filePaths {
+		for _, mode := range DedupModes {
+			b.Run(fmt.Sprintf("File: %s/Mode: %s", filepath.Base(filePath), mode), func(b *testing.B) {
+				config := *config
+				config.DedupMode = mode
+				config.DedupSpillDir = b.TempDir()
+				b.ReportAllocs()
+
+				var result *Result
+				for i := 0; i < b.N; i++ {
+					result, err = RunFiles(context.Background(), log, &config, filePath)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(result.UniqueCustomers), "unique")
+			})
+		}
+	}
+}
+
+// generateCustomersFile writes a CSV file of the given number of customers to a temporary directory and returns its
+// path. Every other row repeats a customer, in a different case, and the customers are spread over 1000 domains.
+func generateCustomersFile(b *testing.B, rows int) string {
+	b.Helper()
+
+	path := filepath.Join(b.TempDir(), fmt.Sprintf("customers_%d_lines.csv", rows))
+	file, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	writer.WriteString("first_name,last_name,email,gender,ip_address\n")
+	for i := 0; i < rows; i++ {
+		customer, name := i/2, "customer"
+		if i%2 == 1 {
+			name = "Customer"
+		}
+		fmt.Fprintf(writer, "John,Doe,%s%d@domain%d.com,Male,10.%d.%d.%d\n", name, customer, customer%1000, i>>16&255, i>>8&255, i&255)
+	}
+	if err := writer.Flush(); err != nil {
+		b.Fatal(err)
+	}
+
+	return path
+}
+
+func BenchmarkBatchSize(b *testing.B) {
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		b.Fatalf("Error loading config: %v", err)
+	}
+
+	filePaths := []string{config.InputCSVFilePath3kLines}
+	if !testing.Short() {
+		filePaths = append(filePaths, generateCustomersFile(b, 1_000_000))
+	}
+
+	for _, filePath := range filePaths {
+		for _, batchSize := range []int{1, 16, 64, 256, 1024, 4096} {
+			b.Run(fmt.Sprintf("File: %s/Batch size: %d", filepath.Base(filePath), batchSize), func(b *testing.B) {
+				config := *config
+				config.BatchSize = batchSize
+				b.ReportAllocs()
+
+				for i := 0; i < b.N; i++ {
+					file, err := os.Open(filePath)
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					reader, err := createCSVfileReader(log, &config, file)
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					_, _, err = processEmailDomainsConcurrently(context.Background(), log, &config, reader, nil, nil)
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					reader.Close()
+					file.Close()
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkReaderMode(b *testing.B) {
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		b.Fatalf("Error loading config: %v", err)
+	}
+
+	filePaths := []string{config.InputCSVFilePath3kLines}
+	if !testing.Short() {
+		filePaths = append(filePaths, generateCustomersFile(b, 10_000_000))
+	}
+
+	for _, filePath := range filePaths {
+		for _, mode := range ReaderModes {
+			for _, concurrency := range []int{1, 2, 4, 8} {
+				b.Run(fmt.Sprintf("File: %s/Reader mode: %s/Concurrency: %d", filepath.Base(filePath), mode, concurrency), func(b *testing.B) {
+					config := *config
+					config.ReaderMode = mode
+					config.Concurrency = concurrency
+					b.ReportAllocs()
+
+					for i := 0; i < b.N; i++ {
+						if _, _, err := importFile(context.Background(), log, &config, filePath, nil); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func BenchmarkFastPath(b *testing.B) {
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		b.Fatalf("Error loading config: %v", err)
+	}
+
+	filePaths := []string{config.InputCSVFilePath3kLines}
+	if !testing.Short() {
+		filePaths = append(filePaths, generateCustomersFile(b, 1_000_000))
+	}
+
+	for _, filePath := range filePaths {
+		for _, fastPath := range []bool{false, true} {
+			b.Run(fmt.Sprintf("File: %s/Fast path: %t", filepath.Base(filePath), fastPath), func(b *testing.B) {
+				config := *config
+				config.FastPath = fastPath
+				b.ReportAllocs()
+
+				for i := 0; i < b.N; i++ {
+					if _, _, err := importFile(context.Background(), log, &config, filePath, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkMmap(b *testing.B) {
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		b.Fatalf("Error loading config: %v", err)
+	}
+
+	filePaths := []string{config.InputCSVFilePath3kLines}
+	if !testing.Short() {
+		filePaths = append(filePaths, generateCustomersFile(b, 10_000_000))
+	}
+
+	for _, filePath := range filePaths {
+		for _, mode := range []string{ReaderModeBuffered, ReaderModeMmap} {
+			for _, bufferSize := range []int{4096, 8192, 16384} {
+				for _, fastPath := range []bool{false, true} {
+					b.Run(fmt.Sprintf("File: %s/Reader mode: %s/Buffer size: %d/Fast path: %t", filepath.Base(filePath), mode, bufferSize, fastPath), func(b *testing.B) {
+						config := *config
+						config.ReaderMode = mode
+						config.ReadBufferSizeInBytes = bufferSize
+						config.FastPath = fastPath
+						b.ReportAllocs()
+
+						for i := 0; i < b.N; i++ {
+							if _, _, err := importFile(context.Background(), log, &config, filePath, nil); err != nil {
+								b.Fatal(err)
+							}
+						}
+					})
+				}
+			}
+		}
+	}
+}
@@ -1,19 +1,21 @@
 package customerimporter
 
 import (
-	"encoding/csv"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"reflect"
-	"regexp"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestProcessEmailDomainsConcurrently(t *testing.T) {
 	// Given
 	log := NewMockLogger()
-	config, err := LoadConfig(log, "./.env")
+	config, err := LoadConfigTest(log, "./.env")
 	if err != nil {
 		t.Fatalf("Error loading config: %v", err)
 	}
@@ -30,7 +32,10 @@ func TestProcessEmailDomainsConcurrently(t *testing.T) {
 	}
 
 	// When
-	emailDomains := processEmailDomainsConcurrently(log, config, reader)
+	emailDomains, stats, err := processEmailDomainsConcurrently(context.Background(), log, config, reader, nil, nil)
+	if err != nil {
+		t.Fatalf("Error processing email domains: %v", err)
+	}
 
 	// Then
 	expectedEmailDomains := map[string]int{
@@ -45,102 +50,475 @@ func TestProcessEmailDomainsConcurrently(t *testing.T) {
 	if !reflect.DeepEqual(emailDomains, expectedEmailDomains) {
 		t.Errorf("Unexpected email domains. Expected: %v, Got: %v", expectedEmailDomains, emailDomains)
 	}
+
+	expectedStats := Stats{RowsRead: 9, RowsRejected: 0}
+	if !reflect.DeepEqual(stats, expectedStats) {
+		t.Errorf("Unexpected stats. Expected: %v, Got: %v", expectedStats, stats)
+	}
 }
 
-func TestEmptyInputFile(t *testing.T) {
+func TestProcessEmailDomainsConcurrentlyBatchSizes(t *testing.T) {
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	testCases := []struct {
+		name      string
+		batchSize int
+	}{
+		{name: "Row per batch", batchSize: 1},
+		{name: "Partial last batch", batchSize: 7},
+		{name: "Default", batchSize: 0},
+		{name: "Whole file in a batch", batchSize: MaxBatchSize},
+	}
+
+	var expectedEmailDomains map[string]int
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			config := *config
+			config.BatchSize = tc.batchSize
+
+			file, err := os.Open(config.InputCSVFilePath3kLines)
+			if err != nil {
+				t.Fatalf("Error opening file: %v", err)
+			}
+			defer file.Close()
+
+			reader, err := createCSVfileReader(log, &config, file)
+			if err != nil {
+				t.Fatalf("Error creating CSV file reader: %v", err)
+			}
+
+			// When
+			emailDomains, stats, err := processEmailDomainsConcurrently(context.Background(), log, &config, reader, nil, nil)
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if expectedEmailDomains == nil {
+				expectedEmailDomains = emailDomains
+			}
+			if len(emailDomains) != 500 || !reflect.DeepEqual(emailDomains, expectedEmailDomains) {
+				t.Errorf("Test %s failed. Expected the same 500 domains for all the batch sizes, Got: %v", tc.name, len(emailDomains))
+			}
+			if stats.RowsRead != 3002 || stats.RowsRejected != 2 {
+				t.Errorf("Test %s failed. Expected: 3002 rows read, 2 rejected, Got: %+v", tc.name, stats)
+			}
+		})
+	}
+}
+
+func TestProcessEmailDomainsConcurrentlyRejectedRows(t *testing.T) {
 	// Given
 	log := NewMockLogger()
-	config, err := LoadConfig(log, "./.env")
+	config, err := LoadConfigTest(log, "./.env")
 	if err != nil {
 		t.Fatalf("Error loading config: %v", err)
 	}
-	reader := csv.NewReader(strings.NewReader(""))
+	reader, err := createCSVfileReader(log, config, strings.NewReader(`first_name,last_name,email,gender,ip_address
+Mildred,Hernandez,mhernandez0@github.io,Female,38.194.51.128
+Bonnie,Ortiz,bortiz1.github.com,Female,197.54.209.129
+Dennis,Henry,dhenry2@hubpages,Male,155.75.186.217
+`))
+	if err != nil {
+		t.Fatalf("Error creating CSV file reader: %v", err)
+	}
 
 	// When
-	emailDomains := processEmailDomainsConcurrently(log, config, reader)
+	emailDomains, stats, err := processEmailDomainsConcurrently(context.Background(), log, config, reader, nil, nil)
+	if err != nil {
+		t.Fatalf("Error processing email domains: %v", err)
+	}
 
 	// Then
-	expectedEmailDomains := map[string]int{}
+	expectedEmailDomains := map[string]int{"github.io": 1}
+	if !reflect.DeepEqual(emailDomains, expectedEmailDomains) {
+		t.Errorf("Unexpected email domains. Expected: %v, Got: %v", expectedEmailDomains, emailDomains)
+	}
 
+	expectedStats := Stats{RowsRead: 3, RowsRejected: 2, ErrorsByReason: map[string]int{ReasonInvalidEmail: 2}}
+	if !reflect.DeepEqual(stats, expectedStats) {
+		t.Errorf("Unexpected stats. Expected: %v, Got: %v", expectedStats, stats)
+	}
+}
+
+func TestProcessEmailDomainsConcurrentlyHeaderColumnOrder(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	config.ColumnAliases = map[string][]string{FieldEmail: {"contact"}}
+	reader, err := createCSVfileReader(log, config, strings.NewReader(`id,Contact,Last Name,First Name,segment
+1,mhernandez0@github.io,Hernandez,Mildred,b2b
+2,bortiz1@github.com,Ortiz,Bonnie,b2c
+3,dhenry2@github.io,Henry,Dennis,b2c
+`))
+	if err != nil {
+		t.Fatalf("Error creating CSV file reader: %v", err)
+	}
+
+	// When
+	emailDomains, _, err := processEmailDomainsConcurrently(context.Background(), log, config, reader, nil, nil)
+	if err != nil {
+		t.Fatalf("Error processing email domains: %v", err)
+	}
+
+	// Then
+	expectedEmailDomains := map[string]int{"github.io": 2, "github.com": 1}
 	if !reflect.DeepEqual(emailDomains, expectedEmailDomains) {
 		t.Errorf("Unexpected email domains. Expected: %v, Got: %v", expectedEmailDomains, emailDomains)
 	}
 }
 
-func TestSortEmailDomains(t *testing.T) {
+func TestProcessEmailDomainsConcurrentlyMalformedRows(t *testing.T) {
+	input := `first_name,last_name,email,gender,ip_address
+Mildred,Hernandez,mhernandez0@github.io,Female,38.194.51.128
+Bonnie,Ortiz,bortiz1@github.com
+Dennis,He"nry,dhenry2@github.io,Male,155.75.186.217
+Justin,Hansen,jhansen3@github.io,Male,251.166.224.119,extra
+`
+
+	testCases := []struct {
+		name                 string
+		lazyQuotes           bool
+		fieldsPerRecord      int
+		expectedEmailDomains map[string]int
+		expectedStats        Stats
+	}{
+		{
+			name:                 "Fields per record of the header",
+			fieldsPerRecord:      0,
+			expectedEmailDomains: map[string]int{"github.io": 1},
+			expectedStats:        Stats{RowsRead: 4, RowsRejected: 3, ErrorsByReason: map[string]int{ReasonMalformedRow: 3}},
+		},
+		{
+			name:                 "Variable fields per record",
+			fieldsPerRecord:      -1,
+			expectedEmailDomains: map[string]int{"github.io": 2},
+			expectedStats:        Stats{RowsRead: 4, RowsRejected: 2, ErrorsByReason: map[string]int{ReasonShortRow: 1, ReasonMalformedRow: 1}},
+		},
+		{
+			name:                 "Variable fields per record with lazy quotes",
+			lazyQuotes:           true,
+			fieldsPerRecord:      -1,
+			expectedEmailDomains: map[string]int{"github.io": 3},
+			expectedStats:        Stats{RowsRead: 4, RowsRejected: 1, ErrorsByReason: map[string]int{ReasonShortRow: 1}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			log := NewMockLogger()
+			config, err := LoadConfigTest(log, "./.env")
+			if err != nil {
+				t.Fatalf("Error loading config: %v", err)
+			}
+			config.LazyQuotes = tc.lazyQuotes
+			config.FieldsPerRecord = tc.fieldsPerRecord
+
+			reader, err := createCSVfileReader(log, config, strings.NewReader(input))
+			if err != nil {
+				t.Fatalf("Error creating CSV file reader: %v", err)
+			}
+
+			// When
+			emailDomains, stats, err := processEmailDomainsConcurrently(context.Background(), log, config, reader, nil, nil)
+			if err != nil {
+				t.Fatalf("Error processing email domains: %v", err)
+			}
+
+			// Then
+			if !reflect.DeepEqual(emailDomains, tc.expectedEmailDomains) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedEmailDomains, emailDomains)
+			}
+			if !reflect.DeepEqual(stats, tc.expectedStats) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedStats, stats)
+			}
+		})
+	}
+}
+
+func TestParseCustomerShortRow(t *testing.T) {
 	// Given
-	emailDomainsWithOccurrences := map[string]int{
-		"github.io":       5,
-		"github.com":      2,
-		"hubpages.com":    1,
-		"statcounter.com": 7,
-		"rediff.com":      4,
-		"cnet.com":        2,
+	record := []string{"Bonnie", "Ortiz", "bortiz1@github.com"}
+
+	// When
+	customer, err := parseCustomer(record, defaultColumnMapping())
+
+	// Then
+	if !errors.Is(err, ErrShortRow) {
+		t.Errorf("Unexpected error. Expected: %v, Got: %v", ErrShortRow, err)
+	}
+	if customer != nil {
+		t.Errorf("Unexpected customer. Expected: %v, Got: %v", nil, customer)
+	}
+}
+
+func TestCreateCSVfileReaderMissingEmailColumn(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
 	}
 
 	// When
-	sortedDomains := sortEmailDomains(emailDomainsWithOccurrences)
+	_, err = createCSVfileReader(log, config, strings.NewReader("first_name,last_name,phone\nMildred,Hernandez,555-0100\n"))
 
 	// Then
-	expectedSortedDomains := []string{"cnet.com", "github.com", "github.io", "hubpages.com", "rediff.com", "statcounter.com"}
+	if !errors.Is(err, ErrEmailColumnNotFound) {
+		t.Errorf("Unexpected error. Expected: %v, Got: %v", ErrEmailColumnNotFound, err)
+	}
+}
 
-	if !reflect.DeepEqual(sortedDomains, expectedSortedDomains) {
-		t.Errorf("Unexpected sorted domains. Expected: %v, Got: %v", expectedSortedDomains, sortedDomains)
+func TestRun(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	// When
+	result, err := Run(context.Background(), log, config)
+	if err != nil {
+		t.Fatalf("Error running import: %v", err)
+	}
+
+	// Then
+	expectedDomains := []DomainCount{
+		{Domain: "cnet.com", Count: 1},
+		{Domain: "github.com", Count: 2},
+		{Domain: "github.io", Count: 3},
+		{Domain: "hubpages.com", Count: 1},
+		{Domain: "rediff.com", Count: 1},
+		{Domain: "statcounter.com", Count: 1},
+	}
+
+	if !reflect.DeepEqual(result.Domains, expectedDomains) {
+		t.Errorf("Unexpected domains. Expected: %v, Got: %v", expectedDomains, result.Domains)
+	}
+
+	expectedStats := Stats{RowsRead: 9, RowsRejected: 0}
+	if !reflect.DeepEqual(result.Stats, expectedStats) {
+		t.Errorf("Unexpected stats. Expected: %v, Got: %v", expectedStats, result.Stats)
+	}
+
+	if result.Duration <= 0 {
+		t.Errorf("Unexpected duration. Expected a positive value, Got: %v", result.Duration)
 	}
 }
 
-func TestExtractDomainInvalidEmail(t *testing.T) {
+func TestRunInvalidConfig(t *testing.T) {
 	// Given
-	email := "invalid.email.com"
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	config.Concurrency = 0 // Zero workers would never consume the tasks.
 
 	// When
-	domain := extractDomain(email)
+	result, err := Run(context.Background(), log, config)
 
 	// Then
-	expectedDomain := ""
-	if !reflect.DeepEqual(domain, expectedDomain) {
-		t.Errorf("Unexpected domain. Expected: %v, Got: %v", expectedDomain, domain)
+	if err == nil || !strings.Contains(err.Error(), "CONCURRENCY must be greater than 0") {
+		t.Errorf("Unexpected error. Expected: %v, Got: %v", "CONCURRENCY must be greater than 0", err)
+	}
+	if result != nil {
+		t.Errorf("Unexpected result. Expected: %v, Got: %v", nil, result)
 	}
 }
 
-func TestExtractDomainWithTestCases(t *testing.T) {
+func TestRunInvalidDefaultInput(t *testing.T) {
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
 	testCases := []struct {
-		name          string
-		email         string
-		expectedValue string
+		name           string
+		path           string
+		expectedErrors []string
 	}{
 		{
-			name:          "OK",
-			email:         "proper.email@gmail.com",
-			expectedValue: "gmail.com",
+			name:           "Input path not set",
+			path:           "",
+			expectedErrors: []string{"INPUT_CSV_FILE_PATH_DEFAULT must be set"},
 		},
 		{
-			name:          "Invalid email",
-			email:         "proper.email.gmail.com",
-			expectedValue: "",
+			name:           "Input file doesn't exist",
+			path:           "../data/test/customers_non_existent.csv",
+			expectedErrors: []string{"INPUT_CSV_FILE_PATH_DEFAULT must be a readable file", "no such file or directory"},
 		},
 		{
-			name:          "Empty string as email",
-			email:         "",
-			expectedValue: "",
+			name:           "Input path is a directory",
+			path:           "../data/test",
+			expectedErrors: []string{"INPUT_CSV_FILE_PATH_DEFAULT must be a readable file", "is a directory"},
 		},
 	}
 
-	for i := range testCases {
-		tc := testCases[i]
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			config := *config
+			config.InputCSVFilePathDefault = tc.path
+
+			// When
+			result, err := Run(context.Background(), log, &config)
+
+			// Then
+			for _, expectedError := range tc.expectedErrors {
+				if err == nil || !strings.Contains(err.Error(), expectedError) {
+					t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, expectedError, err)
+				}
+			}
+			if result != nil {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, nil, result)
+			}
+		})
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// When
+	result, err := Run(ctx, log, config)
+
+	// Then
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error. Expected: %v, Got: %v", context.Canceled, err)
+	}
+	if result == nil || result.RowsRead != 0 {
+		t.Errorf("Unexpected result. Expected a partial result with no rows read, Got: %+v", result)
+	}
+}
 
+func TestProcessEmailDomainsConcurrentlyStopsOnContextDone(t *testing.T) {
+	testCases := []struct {
+		name        string
+		newContext  func() (context.Context, context.CancelFunc)
+		expectedErr error
+	}{
+		{
+			name: "Cancelled",
+			newContext: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(20*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			expectedErr: context.Canceled,
+		},
+		{
+			name: "Timed out",
+			newContext: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			expectedErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			// Given, When
-			domain := extractDomain(tc.email)
+			// Given
+			log := NewMockLogger()
+			config, err := LoadConfigTest(log, "./.env")
+			if err != nil {
+				t.Fatalf("Error loading config: %v", err)
+			}
+			input := io.MultiReader(strings.NewReader("first_name,last_name,email,gender,ip_address\n"), &endlessReader{line: []byte("Mildred,Hernandez,mhernandez0@github.io,Female,38.194.51.128\n")})
+			reader, err := createCSVfileReader(log, config, input)
+			if err != nil {
+				t.Fatalf("Error creating CSV file reader: %v", err)
+			}
+			ctx, cancel := tc.newContext()
+			defer cancel()
+
+			// When
+			emailDomains, stats, err := processEmailDomainsConcurrently(ctx, log, config, reader, nil, nil)
 
 			// Then
-			if !reflect.DeepEqual(domain, tc.expectedValue) {
-				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, domain)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedErr, err)
+			}
+			if stats.RowsRead == 0 || emailDomains["github.io"] != stats.RowsRead {
+				t.Errorf("Test %s failed. Expected partial counts of all the rows read, Got: %v, %+v", tc.name, emailDomains, stats)
 			}
 		})
 	}
 }
 
+func TestEmptyInputFile(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	reader, err := createCSVfileReader(log, config, strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("Error creating CSV file reader: %v", err)
+	}
+
+	// When
+	emailDomains, stats, err := processEmailDomainsConcurrently(context.Background(), log, config, reader, nil, nil)
+	if err != nil {
+		t.Fatalf("Error processing email domains: %v", err)
+	}
+
+	// Then
+	expectedEmailDomains := map[string]int{}
+
+	if !reflect.DeepEqual(stats, Stats{}) {
+		t.Errorf("Unexpected stats. Expected: %v, Got: %v", Stats{}, stats)
+	}
+
+	if !reflect.DeepEqual(emailDomains, expectedEmailDomains) {
+		t.Errorf("Unexpected email domains. Expected: %v, Got: %v", expectedEmailDomains, emailDomains)
+	}
+}
+
+func TestSortDomainCounts(t *testing.T) {
+	// Given
+	emailDomainsWithOccurrences := map[string]int{
+		"github.io":       5,
+		"github.com":      2,
+		"hubpages.com":    1,
+		"statcounter.com": 7,
+		"rediff.com":      4,
+		"cnet.com":        2,
+	}
+
+	// When
+	domainCounts, err := sortDomainCounts(emailDomainsWithOccurrences, SortNameAsc, 0)
+	if err != nil {
+		t.Fatalf("Error sorting email domains: %v", err)
+	}
+
+	// Then
+	expectedSortedDomains := []string{"cnet.com", "github.com", "github.io", "hubpages.com", "rediff.com", "statcounter.com"}
+
+	if sortedDomains := domainNames(domainCounts); !reflect.DeepEqual(sortedDomains, expectedSortedDomains) {
+		t.Errorf("Unexpected sorted domains. Expected: %v, Got: %v", expectedSortedDomains, sortedDomains)
+	}
+}
+
 func TestEmailValidation(t *testing.T) {
 	testCases := []struct {
 		name          string
@@ -162,14 +540,23 @@ func TestEmailValidation(t *testing.T) {
 			email:         "missing@domain",
 			expectedValue: false,
 		},
+		{
+			name:          "Punycode top-level domain",
+			email:         "test@xn--e1afmkfd.xn--p1ai",
+			expectedValue: true,
+		},
+		{
+			name:          "Punycode prefix without label",
+			email:         "test@example.xn--",
+			expectedValue: false,
+		},
 	}
 
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			// Given, When
-			isValid := emailRegex.MatchString(tc.email)
+			localPart, domain, ok := splitEmail(tc.email)
+			isValid := ok && lenientEmailValidator{}.Validate(localPart, domain) == nil
 
 			// Then
 			if isValid != tc.expectedValue {
@@ -202,8 +589,6 @@ func TestDomainValidation(t *testing.T) {
 		},
 	}
 
-	domainRegex := regexp.MustCompile(`^[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			// Given, When
@@ -217,6 +602,23 @@ func TestDomainValidation(t *testing.T) {
 	}
 }
 
+// endlessReader is an io.Reader repeating the same line forever.
+type endlessReader struct {
+	line   []byte
+	offset int
+}
+
+// Read fills p with the repeated line.
+func (r *endlessReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		copied := copy(p[n:], r.line[r.offset:])
+		n += copied
+		r.offset = (r.offset + copied) % len(r.line)
+	}
+	return n, nil
+}
+
 // NewMockLogger is a helper function to create a mock logger for testing.
 func NewMockLogger() *MockLogger {
 	return &MockLogger{}
@@ -0,0 +1,95 @@
+package customerimporter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression formats of the input CSV files.
+const (
+	CompressionNone  = "none"
+	CompressionGzip  = "gzip"
+	CompressionBzip2 = "bzip2"
+	CompressionZstd  = "zstd"
+)
+
+// compressionExtensions are the file extensions of the compressed input files.
+var compressionExtensions = []string{".gz", ".bz2", ".zst"}
+
+// Magic bytes at the start of the compressed files.
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// detectCompression returns the compression format of the data by its magic bytes, without consuming them.
+// The file extension isn't needed, so compressed data piped to the standard input is detected too.
+func detectCompression(r *bufio.Reader) (string, error) {
+	magic, err := r.Peek(len(zstdMagic)) // The longest of the magic bytes.
+	if err != nil && err != io.EOF {     // Data shorter than the magic bytes isn't compressed.
+		return "", err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return CompressionGzip, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return CompressionBzip2, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		return CompressionZstd, nil
+	default:
+		return CompressionNone, nil
+	}
+}
+
+// decompress wraps r with the decompressor of the given compression format. The returned closer releases the
+// decompressor and must be called once reading is done. Data which isn't compressed is returned as is.
+func decompress(r *bufio.Reader, compression string) (io.Reader, io.Closer, error) {
+	switch compression {
+	case CompressionGzip:
+		reader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening gzip stream: %w", err)
+		}
+		return reader, reader, nil
+
+	case CompressionBzip2:
+		return bzip2.NewReader(r), nopCloser{}, nil
+
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening zstd stream: %w", err)
+		}
+		return decoder, zstdCloser{decoder}, nil
+
+	default:
+		return r, nopCloser{}, nil
+	}
+}
+
+// zstdCloser closes a zstd decoder, whose Close method doesn't return an error.
+type zstdCloser struct {
+	decoder *zstd.Decoder
+}
+
+// Close releases the decoder's goroutines.
+func (c zstdCloser) Close() error {
+	c.decoder.Close()
+	return nil
+}
+
+// nopCloser is a closer which does nothing, used for the readers with nothing to release.
+type nopCloser struct{}
+
+// Close does nothing.
+func (nopCloser) Close() error {
+	return nil
+}
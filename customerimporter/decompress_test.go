@@ -0,0 +1,103 @@
+package customerimporter
+
+import (
+	"bufio"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunCompressedFiles(t *testing.T) {
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	expected, err := RunFiles(context.Background(), log, config, config.InputCSVFilePath3kLines)
+	if err != nil {
+		t.Fatalf("Error running import: %v", err)
+	}
+
+	testCases := []struct {
+		name      string
+		extension string
+	}{
+		{name: "Gzip", extension: ".gz"},
+		{name: "Bzip2", extension: ".bz2"},
+		{name: "Zstd", extension: ".zst"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			path := config.InputCSVFilePath3kLines + tc.extension
+
+			// When
+			result, err := RunFiles(context.Background(), log, config, path)
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if !reflect.DeepEqual(result.Domains, expected.Domains) {
+				t.Errorf("Test %s failed. Expected: %v domains, Got: %v", tc.name, len(expected.Domains), len(result.Domains))
+			}
+			if !reflect.DeepEqual(result.Stats, expected.Stats) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, expected.Stats, result.Stats)
+			}
+		})
+	}
+}
+
+func TestDetectCompression(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		expectedValue string
+	}{
+		{name: "Empty", input: "", expectedValue: CompressionNone},
+		{name: "Shorter than the magic bytes", input: "a", expectedValue: CompressionNone},
+		{name: "CSV", input: "first_name,last_name,email\n", expectedValue: CompressionNone},
+		{name: "Gzip", input: "\x1f\x8b\x08\x00", expectedValue: CompressionGzip},
+		{name: "Bzip2", input: "BZh91AY", expectedValue: CompressionBzip2},
+		{name: "Zstd", input: "\x28\xb5\x2f\xfd\x00", expectedValue: CompressionZstd},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			reader := bufio.NewReader(strings.NewReader(tc.input))
+
+			// When
+			compression, err := detectCompression(reader)
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if compression != tc.expectedValue {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, compression)
+			}
+			if reader.Buffered() != len(tc.input) && len(tc.input) < reader.Size() {
+				t.Errorf("Test %s failed. Expected the magic bytes not to be consumed, Got: %v buffered bytes", tc.name, reader.Buffered())
+			}
+		})
+	}
+}
+
+func TestCreateCSVfileReaderCorruptedGzip(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config := &Config{ReadBufferSizeInBytes: DefaultReadBufferSizeInBytes}
+	input := "\x1f\x8b\x08\x00 not really gzip"
+
+	// When
+	reader, err := createCSVfileReader(log, config, strings.NewReader(input))
+
+	// Then
+	if err == nil || reader != nil {
+		t.Errorf("Unexpected result. Expected an error, Got: %v, %v", reader, err)
+	}
+}
@@ -0,0 +1,250 @@
+package customerimporter
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Canonicalization rules of the email addresses, applied on top of lowercasing when deduplicating customers.
+const (
+	DedupRuleGmail = "gmail" // Gmail ignores the dots and the +tag of the local part, googlemail.com is gmail.com.
+	DedupRulePlus  = "plus"  // Ignore the +tag of the local part on all the domains, e.g. john+promo@example.com.
+)
+
+// DedupRules lists the supported canonicalization rules.
+var DedupRules = []string{DedupRuleGmail, DedupRulePlus}
+
+// DefaultDedupRules are the canonicalization rules used when DEDUP_RULES isn't set.
+var DefaultDedupRules = []string{DedupRuleGmail}
+
+// DefaultDedupMaxInMemory is the number of distinct emails kept in memory before spilling them to disk, used when
+// DEDUP_MAX_IN_MEMORY isn't set. A million emails take roughly 100MB.
+const DefaultDedupMaxInMemory = 1_000_000
+
+// dedupPartitions is the number of files the emails are spilled to. Each of them is loaded in memory on its own,
+// so counting takes about 1/dedupPartitions of the memory needed by all the distinct emails.
+const dedupPartitions = 64
+
+// validateDedupRules returns an error if any of the rules isn't supported.
+func validateDedupRules(rules []string) error {
+	for _, rule := range rules {
+		if rule != DedupRuleGmail && rule != DedupRulePlus {
+			return fmt.Errorf("unknown dedup rule %q, expected any of %q", rule, DedupRules)
+		}
+	}
+	return nil
+}
+
+// canonicalEmail returns the canonical form of the email address, the same for all the spellings of a customer's
+// address: it is lowercased and the given provider rules are applied. The domain is already normalized.
+func canonicalEmail(localPart, domain string, rules []string) string {
+	localPart = strings.ToLower(localPart)
+
+	for _, rule := range rules {
+		switch rule {
+		case DedupRuleGmail:
+			if domain != "gmail.com" && domain != "googlemail.com" {
+				continue
+			}
+			domain = "gmail.com"
+			localPart = strings.ReplaceAll(stripTag(localPart), ".", "")
+		case DedupRulePlus:
+			localPart = stripTag(localPart)
+		}
+	}
+
+	return localPart + "@" + domain
+}
+
+// stripTag removes the +tag (subaddress) from the local part, e.g. john+promo becomes john.
+func stripTag(localPart string) string {
+	if plus := strings.IndexByte(localPart, '+'); plus > 0 {
+		return localPart[:plus]
+	}
+	return localPart
+}
+
+// uniqueCounter counts the unique customers per domain. It isn't safe for concurrent use, the collector of the
+// pipeline adds the emails.
+type uniqueCounter interface {
+	// Add adds the customer's canonical email to the domain the customer was counted in.
+	Add(domain, email string) error
+	// Counts returns the number of unique customers per domain and their total.
+	Counts() (map[string]int, int, error)
+	// Close releases the resources, e.g. removes the spill files.
+	Close() error
+}
+
+// newUniqueCounter returns the uniqueCounter of the config, or nil if customers aren't deduplicated.
+func newUniqueCounter(config *Config) uniqueCounter {
+	if !config.Dedup {
+		return nil
+	}
+
+	if config.DedupMode == DedupModeHLL {
+		return newHLLUniqueCounter(hllPrecision(config))
+	}
+
+	maxInMemory := config.DedupMaxInMemory
+	if maxInMemory <= 0 {
+		maxInMemory = DefaultDedupMaxInMemory
+	}
+
+	return &exactUniqueCounter{
+		emails:      make(map[string]string),
+		maxInMemory: maxInMemory,
+		spillDir:    config.DedupSpillDir,
+	}
+}
+
+// exactUniqueCounter counts the unique customers exactly. It keeps the distinct emails in memory up to maxInMemory
+// of them, then spills them to partition files on disk by their hash, so the same email always lands in the same
+// partition. The partitions are then counted one by one, bounding the memory to the largest partition.
+type exactUniqueCounter struct {
+	emails      map[string]string // Email to the smallest domain it was counted in, until spilled.
+	maxInMemory int
+	spillDir    string
+	dir         string // Directory of the partition files, once spilled.
+	partitions  []*os.File
+	writers     []*bufio.Writer
+	line        []byte // Line of a partition file, reused by spill.
+}
+
+// Add adds the email, spilling the emails to disk once there are too many of them. An email counted in several
+// domains is kept in the smallest of them, so the result doesn't depend on the order the workers add the emails in.
+func (c *exactUniqueCounter) Add(domain, email string) error {
+	if c.partitions != nil {
+		return c.spill(domain, email)
+	}
+
+	if seen, ok := c.emails[email]; ok {
+		if domain < seen {
+			c.emails[email] = domain
+		}
+		return nil
+	}
+	c.emails[email] = domain
+
+	if len(c.emails) <= c.maxInMemory {
+		return nil
+	}
+
+	if err := c.createPartitions(); err != nil {
+		return err
+	}
+	for email, domain := range c.emails {
+		if err := c.spill(domain, email); err != nil {
+			return err
+		}
+	}
+	c.emails = nil
+
+	return nil
+}
+
+// createPartitions creates the partition files in a new temporary directory.
+func (c *exactUniqueCounter) createPartitions() error {
+	dir, err := os.MkdirTemp(c.spillDir, "csv-reader-dedup-")
+	if err != nil {
+		return fmt.Errorf("creating the dedup spill directory: %w", err)
+	}
+	c.dir = dir
+
+	for i := 0; i < dedupPartitions; i++ {
+		file, err := os.CreateTemp(dir, "partition-")
+		if err != nil {
+			return fmt.Errorf("creating a dedup spill file: %w", err)
+		}
+		c.partitions = append(c.partitions, file)
+		c.writers = append(c.writers, bufio.NewWriter(file))
+	}
+
+	return nil
+}
+
+// spill appends the email and its domain to the partition of the email. Both are quoted, as the values of the group
+// keys (e.g. a column:<name> value) may hold tabs and line breaks.
+func (c *exactUniqueCounter) spill(domain, email string) error {
+	hash := fnv.New32a()
+	hash.Write([]byte(email))
+	writer := c.writers[hash.Sum32()%dedupPartitions]
+
+	c.line = strconv.AppendQuote(c.line[:0], domain)
+	c.line = append(c.line, '\t')
+	c.line = strconv.AppendQuote(c.line, email)
+	c.line = append(c.line, '\n')
+	_, err := writer.Write(c.line) // The writer's errors are sticky, the last write reports any of them.
+	return err
+}
+
+// parseSpilled returns the domain and the email of a line of a partition file.
+func parseSpilled(line string) (domain, email string, err error) {
+	quotedDomain, quotedEmail, _ := strings.Cut(line, "\t") // A quoted string holds no raw tab.
+	if domain, err = strconv.Unquote(quotedDomain); err != nil {
+		return "", "", err
+	}
+	if email, err = strconv.Unquote(quotedEmail); err != nil {
+		return "", "", err
+	}
+	return domain, email, nil
+}
+
+// Counts counts the emails in memory, or the partitions one by one if the emails were spilled. A customer found in
+// several domains (e.g. both gmail.com and googlemail.com) is counted once, in the smallest of them.
+func (c *exactUniqueCounter) Counts() (map[string]int, int, error) {
+	counts := make(map[string]int)
+
+	if c.partitions == nil {
+		for _, domain := range c.emails {
+			counts[domain]++
+		}
+		return counts, len(c.emails), nil
+	}
+
+	total := 0
+	for i, file := range c.partitions {
+		if err := c.writers[i].Flush(); err != nil {
+			return nil, 0, err
+		}
+		if _, err := file.Seek(0, 0); err != nil {
+			return nil, 0, err
+		}
+
+		seen := make(map[string]string) // Email to the smallest domain it was counted in.
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			domain, email, err := parseSpilled(scanner.Text())
+			if err != nil {
+				return nil, 0, fmt.Errorf("reading a dedup spill file: %w", err)
+			}
+			if smallest, ok := seen[email]; !ok || domain < smallest {
+				seen[email] = domain
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, 0, fmt.Errorf("reading a dedup spill file: %w", err)
+		}
+		for _, domain := range seen {
+			counts[domain]++
+		}
+		total += len(seen)
+	}
+
+	return counts, total, nil
+}
+
+// Close closes and removes the partition files, if the emails were spilled.
+func (c *exactUniqueCounter) Close() error {
+	for _, file := range c.partitions {
+		file.Close()
+	}
+	if c.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(c.dir)
+}
@@ -0,0 +1,255 @@
+package customerimporter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalEmail(t *testing.T) {
+	testCases := []struct {
+		name          string
+		localPart     string
+		domain        string
+		rules         []string
+		expectedValue string
+	}{
+		{name: "Lowercase", localPart: "John.Doe", domain: "github.com", rules: nil, expectedValue: "john.doe@github.com"},
+		{name: "Gmail dots and tag", localPart: "John.Doe+promo", domain: "gmail.com", rules: []string{DedupRuleGmail}, expectedValue: "johndoe@gmail.com"},
+		{name: "Googlemail", localPart: "john.doe", domain: "googlemail.com", rules: []string{DedupRuleGmail}, expectedValue: "johndoe@gmail.com"},
+		{name: "Gmail rule on other domains", localPart: "john.doe+promo", domain: "github.com", rules: []string{DedupRuleGmail}, expectedValue: "john.doe+promo@github.com"},
+		{name: "Plus rule", localPart: "john.doe+promo", domain: "github.com", rules: []string{DedupRulePlus}, expectedValue: "john.doe@github.com"},
+		{name: "Leading plus kept", localPart: "+promo", domain: "github.com", rules: []string{DedupRulePlus}, expectedValue: "+promo@github.com"},
+		{name: "No rules", localPart: "john.doe+promo", domain: "gmail.com", rules: nil, expectedValue: "john.doe+promo@gmail.com"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given, When
+			email := canonicalEmail(tc.localPart, tc.domain, tc.rules)
+
+			// Then
+			if email != tc.expectedValue {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, email)
+			}
+		})
+	}
+}
+
+func TestExactUniqueCounter(t *testing.T) {
+	emails := []struct{ domain, email string }{
+		{"github.com", "a@github.com"},
+		{"github.com", "b@github.com"},
+		{"github.com", "a@github.com"},
+		{"googlemail.com", "johndoe@gmail.com"},
+		{"gmail.com", "johndoe@gmail.com"}, // The same customer, counted in the smallest domain.
+		{"github.io", "c@github.io"},
+		{"github.com", "b@github.com"},
+	}
+	expectedCounts := map[string]int{"github.com": 2, "gmail.com": 1, "github.io": 1}
+
+	testCases := []struct {
+		name        string
+		maxInMemory int
+	}{
+		{name: "In memory", maxInMemory: 100},
+		{name: "Spilled to disk", maxInMemory: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			spillDir := t.TempDir()
+			counter := newUniqueCounter(&Config{Dedup: true, DedupMaxInMemory: tc.maxInMemory, DedupSpillDir: spillDir})
+
+			// When
+			for _, e := range emails {
+				if err := counter.Add(e.domain, e.email); err != nil {
+					t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+				}
+			}
+			counts, total, err := counter.Counts()
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if !reflect.DeepEqual(counts, expectedCounts) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, expectedCounts, counts)
+			}
+			if total != 4 {
+				t.Errorf("Test %s failed. Expected total: %v, Got: %v", tc.name, 4, total)
+			}
+
+			if err := counter.Close(); err != nil {
+				t.Fatalf("Test %s failed. Unexpected error closing: %v", tc.name, err)
+			}
+			if entries, _ := os.ReadDir(spillDir); len(entries) != 0 {
+				t.Errorf("Test %s failed. Expected the spill files to be removed, Got: %v", tc.name, entries)
+			}
+		})
+	}
+}
+
+func TestRunFilesDedup(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	config.Dedup = true
+	config.DedupRules = DefaultDedupRules
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"customers_1.csv": "email\nJohn.Doe+promo@gmail.com\njohndoe@gmail.com\na@github.com\n",
+		"customers_2.csv": "email\nA@GitHub.com\njohn.doe@googlemail.com\nb@github.com\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Error writing CSV file: %v", err)
+		}
+	}
+
+	// When
+	result, err := RunFiles(context.Background(), log, config, filepath.Join(dir, "customers_*.csv"))
+
+	// Then
+	if err != nil {
+		t.Fatalf("Error running import: %v", err)
+	}
+
+	expectedDomains := []DomainCount{
+		{Domain: "github.com", Count: 3, Unique: 2},
+		{Domain: "gmail.com", Count: 2, Unique: 1},
+		{Domain: "googlemail.com", Count: 1, Unique: 0}, // The customer is counted in gmail.com, the smallest domain.
+	}
+	if !reflect.DeepEqual(result.Domains, expectedDomains) {
+		t.Errorf("Unexpected domains. Expected: %v, Got: %v", expectedDomains, result.Domains)
+	}
+	if !result.Deduplicated || result.UniqueCustomers != 3 {
+		t.Errorf("Unexpected unique customers. Expected: %v, Got: %v", 3, result.UniqueCustomers)
+	}
+}
+
+func TestRunDedupConcurrently(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	config.Concurrency = 8
+	config.Dedup = true
+	config.DedupRules = DefaultDedupRules
+
+	// Blocks of a batch of rows alternating the two domains of the same customers, so the batches of the workers
+	// reach the collector in any order.
+	var data strings.Builder
+	data.WriteString("email\n")
+	for block := 0; block < 16; block++ {
+		domain := "googlemail.com" // Found first, but not the smallest domain.
+		if block%2 == 1 {
+			domain = "gmail.com"
+		}
+		for i := 0; i < DefaultBatchSize; i++ {
+			fmt.Fprintf(&data, "customer%d@%s\n", i, domain)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "customers.csv")
+	if err := os.WriteFile(path, []byte(data.String()), 0o644); err != nil {
+		t.Fatalf("Error writing CSV file: %v", err)
+	}
+
+	expectedDomains := []DomainCount{
+		{Domain: "gmail.com", Count: 8 * DefaultBatchSize, Unique: DefaultBatchSize},
+		{Domain: "googlemail.com", Count: 8 * DefaultBatchSize, Unique: 0},
+	}
+
+	testCases := []struct {
+		name        string
+		maxInMemory int
+	}{
+		{name: "In memory", maxInMemory: 0},
+		{name: "Spilled to disk", maxInMemory: 16},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := *config
+			config.DedupMaxInMemory = tc.maxInMemory
+			config.DedupSpillDir = t.TempDir()
+
+			for run := 0; run < 10; run++ {
+				// When
+				result, err := RunFiles(context.Background(), log, &config, path)
+				if err != nil {
+					t.Fatalf("Error running import: %v", err)
+				}
+
+				// Then
+				if !reflect.DeepEqual(result.Domains, expectedDomains) {
+					t.Fatalf("Test %s failed. Expected: %v, Got: %v", tc.name, expectedDomains, result.Domains)
+				}
+			}
+		})
+	}
+}
+
+func TestRunDedupGroupBySpilled(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	config.Dedup = true
+	config.GroupBy = []string{"column:notes"}
+
+	data := "email,notes\n" +
+		"a@github.com,\"tab\tin the notes\"\n" +
+		"b@github.com,\"line\nbreak\"\n" +
+		"c@github.com,\"tab\tin the notes\"\n" +
+		"a@github.com,\"tab\tin the notes\"\n"
+	path := filepath.Join(t.TempDir(), "customers.csv")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("Error writing CSV file: %v", err)
+	}
+
+	expectedDomains := []DomainCount{
+		{Key: []string{"line\nbreak"}, Count: 1, Unique: 1},
+		{Key: []string{"tab\tin the notes"}, Count: 3, Unique: 2},
+	}
+
+	testCases := []struct {
+		name        string
+		maxInMemory int
+	}{
+		{name: "In memory", maxInMemory: 0},
+		{name: "Spilled to disk", maxInMemory: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := *config
+			config.DedupMaxInMemory = tc.maxInMemory
+			config.DedupSpillDir = t.TempDir()
+
+			// When
+			result, err := RunFiles(context.Background(), log, &config, path)
+
+			// Then
+			if err != nil {
+				t.Fatalf("Error running import: %v", err)
+			}
+			if !reflect.DeepEqual(result.Domains, expectedDomains) || result.UniqueCustomers != 3 {
+				t.Errorf("Test %s failed. Expected: %v and 3 unique customers, Got: %v and %v", tc.name, expectedDomains, result.Domains, result.UniqueCustomers)
+			}
+		})
+	}
+}
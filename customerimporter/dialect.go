@@ -0,0 +1,165 @@
+package customerimporter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// DefaultDelimiter is the field delimiter used when CSV_DELIMITER isn't set.
+const DefaultDelimiter = ','
+
+// sniffedDelimiters lists the delimiters the sniffer chooses from, in order of preference on a tie.
+var sniffedDelimiters = []rune{',', ';', '\t', '|'}
+
+// Sniffing looks at up to this many lines (and at most the read buffer) at the start of the input.
+const (
+	sniffLines     = 10
+	maxSniffLength = 64 * 1024
+)
+
+// utf8BOM is the byte order mark some tools (e.g. Excel) write at the start of UTF-8 files.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// ParseCSVRune parses a delimiter or comment character given as a single character, e.g. ";" or "#". Tabs can be
+// given as "\t" or "tab" as they are hard to pass in .env files and on the command line.
+func ParseCSVRune(value string) (rune, error) {
+	switch value {
+	case `\t`, "tab":
+		return '\t', nil
+	}
+
+	if utf8.RuneCountInString(value) != 1 {
+		return 0, fmt.Errorf("expected a single character, got %q", value)
+	}
+
+	r, _ := utf8.DecodeRuneInString(value)
+	return r, nil
+}
+
+// validateDialect checks the delimiter and the comment character the same way csv.Reader does, so invalid values are
+// reported along with the other config problems rather than on the first read.
+func validateDialect(delimiter, comment rune) []error {
+	var errs []error
+
+	valid := func(r rune) bool {
+		return r != '"' && r != '\r' && r != '\n' && utf8.ValidRune(r) && r != utf8.RuneError
+	}
+
+	if delimiter != 0 && !valid(delimiter) {
+		errs = append(errs, fmt.Errorf("CSV_DELIMITER must not be a quote, a line break or an invalid character. But was %q", delimiter))
+	}
+
+	if comment != 0 && !valid(comment) {
+		errs = append(errs, fmt.Errorf("CSV_COMMENT must not be a quote, a line break or an invalid character. But was %q", comment))
+	}
+
+	if comment != 0 && comment == delimiterOrDefault(delimiter) {
+		errs = append(errs, fmt.Errorf("CSV_COMMENT must differ from CSV_DELIMITER. But both were %q", comment))
+	}
+
+	return errs
+}
+
+// delimiterOrDefault returns the delimiter, or the default comma if it isn't set.
+func delimiterOrDefault(delimiter rune) rune {
+	if delimiter == 0 {
+		return DefaultDelimiter
+	}
+	return delimiter
+}
+
+// stripBOM discards the UTF-8 byte order mark at the start of the input, if there is one, so it doesn't end up in the
+// name of the first header column.
+func stripBOM(r *bufio.Reader) error {
+	prefix, err := r.Peek(len(utf8BOM))
+	if err != nil && len(prefix) < len(utf8BOM) { // Too short to start with a BOM, reading reports any other error.
+		return nil
+	}
+
+	if bytes.Equal(prefix, utf8BOM) {
+		_, err = r.Discard(len(utf8BOM))
+	}
+	return err
+}
+
+// sniffDelimiter guesses the delimiter from the first lines of the input without consuming them. It picks the
+// candidate found the same number of times in every line, preferring the most frequent one, as a delimiter appears
+// in every record while a stray ';' or '|' in a value doesn't. Delimiters inside quoted fields aren't counted and the
+// comment lines are skipped. It returns false if none of the candidates fits.
+func sniffDelimiter(r *bufio.Reader, comment rune) (rune, bool) {
+	sample, err := r.Peek(min(r.Size(), maxSniffLength))
+	if err != nil && len(sample) == 0 {
+		return 0, false
+	}
+	complete := err != nil // The whole input fits in the sample, so its last line is complete.
+
+	var (
+		lines    []map[rune]int
+		counts   = make(map[rune]int)
+		inQuotes bool
+		empty    = true // No characters in the line yet.
+		skip     bool   // Within a comment line.
+	)
+
+	endLine := func() {
+		if !empty && !skip {
+			lines = append(lines, counts)
+		}
+		counts, empty, skip = make(map[rune]int), true, false
+	}
+
+	for _, c := range string(sample) {
+		if len(lines) == sniffLines {
+			break
+		}
+
+		if empty && c != '\n' && c != '\r' {
+			empty = false
+			skip = comment != 0 && c == comment
+		}
+
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == '\n' && !inQuotes:
+			endLine()
+		case !inQuotes:
+			counts[c]++
+		}
+	}
+	if complete && len(lines) < sniffLines { // The last line may not end with a line break.
+		endLine()
+	}
+
+	var (
+		best      rune
+		bestCount int
+	)
+	for _, candidate := range sniffedDelimiters {
+		count := consistentCount(lines, candidate)
+		if count > bestCount {
+			best, bestCount = candidate, count
+		}
+	}
+
+	return best, bestCount > 0
+}
+
+// consistentCount returns how many times the candidate appears in each of the lines, or 0 if the count differs
+// between the lines.
+func consistentCount(lines []map[rune]int, candidate rune) int {
+	if len(lines) == 0 {
+		return 0
+	}
+
+	count := lines[0][candidate]
+	for _, line := range lines[1:] {
+		if line[candidate] != count {
+			return 0
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,202 @@
+package customerimporter
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunReaderDialects(t *testing.T) {
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	expectedDomains := []DomainCount{
+		{Domain: "cyberchimps.com", Count: 1},
+		{Domain: "github.io", Count: 2},
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(config *Config)
+		input  string
+	}{
+		{
+			name:   "Semicolons",
+			modify: func(config *Config) { config.Delimiter = ';' },
+			input: "first_name;last_name;email\n" +
+				"Mildred;Hernandez;mhernandez0@github.io\n" +
+				"Bonnie;Ortiz;bortiz1@cyberchimps.com\n" +
+				"Dennis;Henry;dhenry2@github.io\n",
+		},
+		{
+			name:   "Tabs sniffed",
+			modify: func(config *Config) { config.SniffDelimiter = true },
+			input: "first_name\tlast_name\temail\n" +
+				"Mildred\tHernandez\tmhernandez0@github.io\n" +
+				"Bonnie\tOrtiz, Jr.\tbortiz1@cyberchimps.com\n" +
+				"Dennis\tHenry\tdhenry2@github.io\n",
+		},
+		{
+			name:   "Comment lines",
+			modify: func(config *Config) { config.Comment = '#' },
+			input: "# Exported from the CRM.\n" +
+				"first_name,last_name,email\n" +
+				"Mildred,Hernandez,mhernandez0@github.io\n" +
+				"# Bonnie,Ortiz,bortiz1@github.com\n" +
+				"Bonnie,Ortiz,bortiz1@cyberchimps.com\n" +
+				"Dennis,Henry,dhenry2@github.io\n",
+		},
+		{
+			name:   "Leading spaces",
+			modify: func(config *Config) { config.TrimLeadingSpace = true },
+			input: "first_name, last_name, email\n" +
+				"Mildred, Hernandez, mhernandez0@github.io\n" +
+				"Bonnie, Ortiz, bortiz1@cyberchimps.com\n" +
+				"Dennis, Henry, dhenry2@github.io\n",
+		},
+		{
+			name:   "UTF-8 BOM",
+			modify: func(config *Config) {},
+			input: "\xef\xbb\xbfemail,first_name\n" +
+				"mhernandez0@github.io,Mildred\n" +
+				"bortiz1@cyberchimps.com,Bonnie\n" +
+				"dhenry2@github.io,Dennis\n",
+		},
+		{
+			name:   "No header",
+			modify: func(config *Config) { config.NoHeader = true },
+			input: "Mildred,Hernandez,mhernandez0@github.io,Female,38.194.51.128\n" +
+				"Bonnie,Ortiz,bortiz1@cyberchimps.com,Female,197.54.209.129\n" +
+				"Dennis,Henry,dhenry2@github.io,Male,155.75.186.217\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			dialectConfig := *config
+			tc.modify(&dialectConfig)
+
+			// When
+			result, err := RunReader(context.Background(), log, &dialectConfig, strings.NewReader(tc.input))
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if !reflect.DeepEqual(result.Domains, expectedDomains) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, expectedDomains, result.Domains)
+			}
+			if result.RowsRead != 3 || result.RowsRejected != 0 {
+				t.Errorf("Test %s failed. Expected: 3 rows read and none rejected, Got: %v", tc.name, result.Stats)
+			}
+		})
+	}
+}
+
+func TestSniffDelimiter(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		comment       rune
+		expectedValue rune
+		expectedOK    bool
+	}{
+		{name: "Commas", input: "a,b,c\n1,2,3\n", expectedValue: ',', expectedOK: true},
+		{name: "Semicolons with commas in values", input: "a;b;c\n1,5;2;3\n4;5,5;6\n", expectedValue: ';', expectedOK: true},
+		{name: "Tabs", input: "a\tb\n1\t2", expectedValue: '\t', expectedOK: true},
+		{name: "Pipes", input: "a|b|c\r\n1|2|3\r\n", expectedValue: '|', expectedOK: true},
+		{name: "Quoted delimiters", input: "a;b\n\"1;2;3\";4\n", expectedValue: ';', expectedOK: true},
+		{name: "Comment lines", input: "# a, b, c, d\na;b\n1;2\n", comment: '#', expectedValue: ';', expectedOK: true},
+		{name: "Single column", input: "email\na@github.io\n", expectedOK: false},
+		{name: "Empty", input: "", expectedOK: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			reader := bufio.NewReader(strings.NewReader(tc.input))
+
+			// When
+			delimiter, ok := sniffDelimiter(reader, tc.comment)
+
+			// Then
+			if ok != tc.expectedOK || delimiter != tc.expectedValue {
+				t.Errorf("Test %s failed. Expected: %q %v, Got: %q %v", tc.name, tc.expectedValue, tc.expectedOK, delimiter, ok)
+			}
+
+			rest, _ := io.ReadAll(reader)
+			if string(rest) != tc.input {
+				t.Errorf("Test %s failed. Expected the input not to be consumed, Got: %q", tc.name, rest)
+			}
+		})
+	}
+}
+
+func TestParseCSVRune(t *testing.T) {
+	testCases := []struct {
+		name          string
+		value         string
+		expectedValue rune
+		expectedErr   bool
+	}{
+		{name: "Semicolon", value: ";", expectedValue: ';'},
+		{name: "Escaped tab", value: `\t`, expectedValue: '\t'},
+		{name: "Tab name", value: "tab", expectedValue: '\t'},
+		{name: "Multi-byte character", value: "§", expectedValue: '§'},
+		{name: "Empty", value: "", expectedErr: true},
+		{name: "Two characters", value: ";;", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given, When
+			r, err := ParseCSVRune(tc.value)
+
+			// Then
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("Test %s failed. Expected error: %v, Got: %v", tc.name, tc.expectedErr, err)
+			}
+			if r != tc.expectedValue {
+				t.Errorf("Test %s failed. Expected: %q, Got: %q", tc.name, tc.expectedValue, r)
+			}
+		})
+	}
+}
+
+func TestStripBOM(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		expectedValue string
+	}{
+		{name: "BOM", input: "\xef\xbb\xbfemail\n", expectedValue: "email\n"},
+		{name: "No BOM", input: "email\n", expectedValue: "email\n"},
+		{name: "Shorter than a BOM", input: "a", expectedValue: "a"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			reader := bufio.NewReader(strings.NewReader(tc.input))
+
+			// When
+			err := stripBOM(reader)
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			rest, _ := io.ReadAll(reader)
+			if string(rest) != tc.expectedValue {
+				t.Errorf("Test %s failed. Expected: %q, Got: %q", tc.name, tc.expectedValue, rest)
+			}
+		})
+	}
+}
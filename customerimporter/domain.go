@@ -0,0 +1,72 @@
+package customerimporter
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Forms of the internationalized domains in the result.
+const (
+	DomainFormPunycode = "punycode" // ASCII Compatible Encoding, e.g. xn--bcher-kva.example.
+	DomainFormUnicode  = "unicode"  // e.g. bücher.example.
+)
+
+// DefaultDomainForm is the domain form used when DOMAIN_FORM isn't set.
+const DefaultDomainForm = DomainFormPunycode
+
+// DomainForms lists the supported domain forms.
+var DomainForms = []string{DomainFormPunycode, DomainFormUnicode}
+
+// validateDomainForm returns an error if the domain form isn't supported. An empty form stands for punycode.
+func validateDomainForm(form string) error {
+	switch form {
+	case "", DomainFormPunycode, DomainFormUnicode:
+		return nil
+	default:
+		return fmt.Errorf("unknown domain form %q, expected one of %q", form, DomainForms)
+	}
+}
+
+// normalizeDomain returns the canonical ASCII form of the domain, so the different spellings of a domain are counted
+// together: the surrounding white space and the trailing dots of fully qualified names are stripped, the letters are
+// lowercased and internationalized domains are converted to punycode (IDNA2008 with the UTS #46 mapping, e.g.
+// Bücher.example becomes xn--bcher-kva.example). It returns an error if the domain isn't a valid IDNA domain.
+func normalizeDomain(domain string) (string, error) {
+	domain = strings.TrimRight(strings.TrimSpace(domain), ".")
+	if isASCII(domain) && !strings.Contains(domain, "xn--") { // Most domains only need lowercasing.
+		return strings.ToLower(domain), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(ascii), nil
+}
+
+// formatDomain returns the normalized domain in the given form. ASCII domains are the same in both forms.
+func formatDomain(domain string, form string) string {
+	if form != DomainFormUnicode || !strings.Contains(domain, "xn--") {
+		return domain
+	}
+
+	unicodeDomain, err := idna.Lookup.ToUnicode(domain)
+	if err != nil { // Already validated while counting, keep the punycode just in case.
+		return domain
+	}
+
+	return unicodeDomain
+}
+
+// isASCII reports whether the string holds ASCII characters only.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
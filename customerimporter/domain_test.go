@@ -0,0 +1,118 @@
+package customerimporter
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	testCases := []struct {
+		name          string
+		domain        string
+		expectedValue string
+		expectedErr   bool
+	}{
+		{name: "Lowercase", domain: "github.com", expectedValue: "github.com"},
+		{name: "Uppercase", domain: "GitHub.COM", expectedValue: "github.com"},
+		{name: "Trailing dot", domain: "github.com.", expectedValue: "github.com"},
+		{name: "White space", domain: " github.com\t", expectedValue: "github.com"},
+		{name: "Unicode", domain: "Bücher.example", expectedValue: "xn--bcher-kva.example"},
+		{name: "Unicode top-level domain", domain: "пример.рф", expectedValue: "xn--e1afmkfd.xn--p1ai"},
+		{name: "Punycode", domain: "XN--BCHER-KVA.example", expectedValue: "xn--bcher-kva.example"},
+		{name: "Fullwidth characters", domain: "ｇｉｔｈｕｂ.com", expectedValue: "github.com"},
+		{name: "Invalid punycode", domain: "xn--a.example", expectedErr: true},
+		{name: "Disallowed character", domain: "bü cher.example", expectedErr: true},
+		{name: "Leading hyphen", domain: "-bücher.example", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given, When
+			domain, err := normalizeDomain(tc.domain)
+
+			// Then
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("Test %s failed. Expected error: %v, Got: %v", tc.name, tc.expectedErr, err)
+			}
+			if domain != tc.expectedValue {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, domain)
+			}
+		})
+	}
+}
+
+func TestRunReaderDomainNormalization(t *testing.T) {
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	input := "email\n" +
+		"a@github.com\n" +
+		"b@GitHub.com\n" +
+		"c@github.com.\n" +
+		"\" d@github.com \"\n" +
+		"e@Bücher.example\n" +
+		"f@xn--bcher-kva.example\n" +
+		"g@пример.рф\n"
+
+	testCases := []struct {
+		name          string
+		form          string
+		expectedValue []DomainCount
+	}{
+		{
+			name: "Punycode",
+			form: DomainFormPunycode,
+			expectedValue: []DomainCount{
+				{Domain: "github.com", Count: 4},
+				{Domain: "xn--bcher-kva.example", Count: 2},
+				{Domain: "xn--e1afmkfd.xn--p1ai", Count: 1},
+			},
+		},
+		{
+			name: "Unicode",
+			form: DomainFormUnicode,
+			expectedValue: []DomainCount{
+				{Domain: "bücher.example", Count: 2},
+				{Domain: "github.com", Count: 4},
+				{Domain: "пример.рф", Count: 1},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			formConfig := *config
+			formConfig.DomainForm = tc.form
+
+			// When
+			result, err := RunReader(context.Background(), log, &formConfig, strings.NewReader(input))
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if !reflect.DeepEqual(result.Domains, tc.expectedValue) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, result.Domains)
+			}
+			if result.RowsRejected != 0 {
+				t.Errorf("Test %s failed. Expected no rejected rows, Got: %v", tc.name, result.ErrorsByReason)
+			}
+		})
+	}
+}
+
+func TestValidateDomainForm(t *testing.T) {
+	// Given, When
+	err := validateDomainForm("ascii")
+
+	// Then
+	if err == nil {
+		t.Errorf("Unexpected result. Expected an error, Got: %v", err)
+	}
+}
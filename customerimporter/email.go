@@ -0,0 +1,253 @@
+package customerimporter
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Email validation modes.
+const (
+	EmailValidationLenient = "lenient" // The ASCII-only pattern of the original importer.
+	EmailValidationStrict  = "strict"  // RFC 5322 addr-spec with the RFC 6531 UTF-8 extensions.
+)
+
+// DefaultEmailValidation is the email validation mode used when EMAIL_VALIDATION isn't set.
+const DefaultEmailValidation = EmailValidationLenient
+
+// EmailValidations lists the supported email validation modes.
+var EmailValidations = []string{EmailValidationLenient, EmailValidationStrict}
+
+// Errors of the email validators, the rows are rejected with the matching reason.
+var (
+	ErrInvalidEmail  = errors.New(ReasonInvalidEmail)
+	ErrInvalidDomain = errors.New(ReasonInvalidDomain)
+)
+
+// Patterns of the lenient validation, compiled once.
+var (
+	domainRegex = regexp.MustCompile(`^[a-zA-Z0-9.-]+\.([a-zA-Z]{2,}|xn--[a-zA-Z0-9-]+)$`)
+	localRegex  = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+$`)
+)
+
+// Length limits of the email addresses (RFC 5321, section 4.5.3.1).
+const (
+	maxEmailLength  = 254
+	maxLocalLength  = 64
+	maxDomainLength = 253
+	maxLabelLength  = 63
+)
+
+// EmailValidator validates the email addresses of the customers. Implementations must be safe for concurrent use,
+// they are shared by the workers.
+type EmailValidator interface {
+	// Validate checks the local part and the domain of an email address, split at its last '@'. The domain is already
+	// normalized to its lowercase ASCII form. It returns an error wrapping ErrInvalidEmail or ErrInvalidDomain if the
+	// address is rejected.
+	Validate(localPart, domain string) error
+}
+
+// NewEmailValidator returns the EmailValidator of the given validation mode. An empty mode stands for lenient.
+func NewEmailValidator(mode string) (EmailValidator, error) {
+	switch mode {
+	case "", EmailValidationLenient:
+		return lenientEmailValidator{}, nil
+	case EmailValidationStrict:
+		return strictEmailValidator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown email validation %q, expected one of %q", mode, EmailValidations)
+	}
+}
+
+// emailValidator returns the validator of the config: the EmailValidator set in code, if any, or the one of the
+// EMAIL_VALIDATION mode.
+func emailValidator(config *Config) (EmailValidator, error) {
+	if config.EmailValidator != nil {
+		return config.EmailValidator, nil
+	}
+	return NewEmailValidator(config.EmailValidation)
+}
+
+// rejectReason returns the reason of the row rejected by an EmailValidator's error.
+func rejectReason(err error) string {
+	if errors.Is(err, ErrInvalidDomain) {
+		return ReasonInvalidDomain
+	}
+	return ReasonInvalidEmail
+}
+
+// splitEmail splits the email address at its last '@', as the local part may hold one when quoted.
+// It returns false if either part is empty.
+func splitEmail(email string) (localPart, domain string, ok bool) {
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 || at == len(email)-1 {
+		return "", "", false
+	}
+	return email[:at], email[at+1:], true
+}
+
+// lenientEmailValidator accepts the ASCII addresses whose local part matches localRegex and domain matches domainRegex,
+// the validation of the original importer.
+// It rejects quoted and Unicode local parts and IP literal domains, but lets through e.g. consecutive dots.
+type lenientEmailValidator struct{}
+
+// Validate checks the address against the lenient patterns. Any mismatch is reported as an invalid email.
+func (lenientEmailValidator) Validate(localPart, domain string) error {
+	if !localRegex.MatchString(localPart) || !domainRegex.MatchString(domain) {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// strictEmailValidator accepts the RFC 5322 addr-spec addresses: a dot-atom or quoted-string local part and a host
+// name or IP literal domain, without comments and folding white space. As of RFC 6531, the local part may hold UTF-8
+// characters (internationalized domains are already in their ASCII form). The RFC 5321 length limits apply too.
+type strictEmailValidator struct{}
+
+// Validate checks the address against the RFC 5322 grammar.
+func (strictEmailValidator) Validate(localPart, domain string) error {
+	if len(localPart)+1+len(domain) > maxEmailLength {
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidEmail, maxEmailLength)
+	}
+
+	if err := validateLocalPart(localPart); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidEmail, err)
+	}
+
+	if strings.HasPrefix(domain, "[") {
+		if err := validateAddressLiteral(domain); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidDomain, err)
+		}
+		return nil
+	}
+
+	if err := validateHostName(domain); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidDomain, err)
+	}
+	return nil
+}
+
+// validateLocalPart checks a dot-atom or quoted-string local part.
+func validateLocalPart(localPart string) error {
+	if len(localPart) > maxLocalLength {
+		return fmt.Errorf("local part longer than %d octets", maxLocalLength)
+	}
+	if !utf8.ValidString(localPart) {
+		return errors.New("local part isn't valid UTF-8")
+	}
+
+	if strings.HasPrefix(localPart, `"`) {
+		return validateQuotedString(localPart)
+	}
+
+	for _, atom := range strings.Split(localPart, ".") {
+		if atom == "" {
+			return errors.New("empty atom in the local part, e.g. consecutive dots")
+		}
+		for _, r := range atom {
+			if !isAtext(r) {
+				return fmt.Errorf("character %q not allowed in an unquoted local part", r)
+			}
+		}
+	}
+	return nil
+}
+
+// isAtext reports whether the character may appear in an atom: the RFC 5322 atext or a RFC 6531 UTF-8 character.
+func isAtext(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	case strings.ContainsRune("!#$%&'*+-/=?^_`{|}~", r):
+		return true
+	default:
+		return r >= utf8.RuneSelf && unicode.IsGraphic(r) && !unicode.IsSpace(r)
+	}
+}
+
+// validateQuotedString checks a quoted-string local part, e.g. "john doe" or "very.(),:;<>[]\".unusual".
+func validateQuotedString(localPart string) error {
+	if len(localPart) < 2 || !strings.HasSuffix(localPart, `"`) {
+		return errors.New("unterminated quoted local part")
+	}
+
+	content := localPart[1 : len(localPart)-1]
+	for i := 0; i < len(content); {
+		r, size := utf8.DecodeRuneInString(content[i:])
+		switch {
+		case r == '\\': // quoted-pair: a backslash followed by a visible character or white space.
+			next, nextSize := utf8.DecodeRuneInString(content[i+size:])
+			if nextSize == 0 || !(next == ' ' || next == '\t' || (next >= '!' && next <= '~') || next >= utf8.RuneSelf) {
+				return errors.New("invalid escape in the quoted local part")
+			}
+			i += size + nextSize
+			continue
+		case r == '"':
+			return errors.New("unescaped quote in the quoted local part")
+		case r == ' ' || r == '\t' || (r >= '!' && r <= '~'):
+		case r >= utf8.RuneSelf && unicode.IsGraphic(r):
+		default:
+			return fmt.Errorf("character %q not allowed in a quoted local part", r)
+		}
+		i += size
+	}
+	return nil
+}
+
+// validateHostName checks a host name domain: at least two labels of letters, digits and hyphens, not starting or
+// ending with a hyphen, and a top-level domain which isn't all digits.
+func validateHostName(domain string) error {
+	if len(domain) > maxDomainLength {
+		return fmt.Errorf("domain longer than %d characters", maxDomainLength)
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return errors.New("domain without a top-level domain")
+	}
+
+	for _, label := range labels {
+		if label == "" || len(label) > maxLabelLength {
+			return fmt.Errorf("domain label %q must have 1 to %d characters", label, maxLabelLength)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("domain label %q must not start or end with a hyphen", label)
+		}
+		for i := 0; i < len(label); i++ {
+			if c := label[i]; !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("character %q not allowed in a domain", c)
+			}
+		}
+	}
+
+	if strings.Trim(labels[len(labels)-1], "0123456789") == "" {
+		return errors.New("numeric top-level domain")
+	}
+	return nil
+}
+
+// validateAddressLiteral checks an IP address literal domain, e.g. [192.168.0.1] or [IPv6:2001:db8::1].
+func validateAddressLiteral(domain string) error {
+	if !strings.HasSuffix(domain, "]") {
+		return errors.New("unterminated address literal")
+	}
+	literal := domain[1 : len(domain)-1]
+
+	if len(literal) > 5 && strings.EqualFold(literal[:5], "ipv6:") {
+		addr, err := netip.ParseAddr(literal[5:])
+		if err != nil || !addr.Is6() || addr.Zone() != "" {
+			return fmt.Errorf("invalid IPv6 address literal %q", literal)
+		}
+		return nil
+	}
+
+	addr, err := netip.ParseAddr(literal)
+	if err != nil || !addr.Is4() {
+		return fmt.Errorf("invalid IPv4 address literal %q", literal)
+	}
+	return nil
+}
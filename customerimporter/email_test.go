@@ -0,0 +1,193 @@
+package customerimporter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEmailValidators(t *testing.T) {
+	testCases := []struct {
+		name            string
+		email           string
+		expectedLenient error
+		expectedStrict  error
+	}{
+		{name: "Simple", email: "john.doe@github.com"},
+		{name: "Plus tag", email: "john+newsletter@github.com"},
+		{name: "Punycode domain", email: "jan@xn--bcher-kva.example"},
+		{name: "Special characters", email: "o'reilly!#$&*/=?^`{|}~@github.com", expectedLenient: ErrInvalidEmail},
+		{name: "Quoted local part", email: `"john doe"@github.com`, expectedLenient: ErrInvalidEmail},
+		{name: "Quoted local part with @ and escapes", email: `"john@\"home\""@github.com`, expectedLenient: ErrInvalidEmail},
+		{name: "Unicode local part", email: "józef@onet.pl", expectedLenient: ErrInvalidEmail},
+		{name: "IPv4 literal", email: "root@[192.168.0.1]", expectedLenient: ErrInvalidEmail},
+		{name: "IPv6 literal", email: "root@[ipv6:2001:db8::1]", expectedLenient: ErrInvalidEmail},
+		{name: "Consecutive dots", email: "john..doe@github.com", expectedStrict: ErrInvalidEmail},
+		{name: "Leading dot", email: ".john@github.com", expectedStrict: ErrInvalidEmail},
+		{name: "Trailing dot", email: "john.@github.com", expectedStrict: ErrInvalidEmail},
+		{name: "Unquoted space", email: "john doe@github.com", expectedLenient: ErrInvalidEmail, expectedStrict: ErrInvalidEmail},
+		{name: "Unterminated quote", email: `"john@github.com`, expectedLenient: ErrInvalidEmail, expectedStrict: ErrInvalidEmail},
+		{name: "Unescaped quote", email: `"jo"hn"@github.com`, expectedLenient: ErrInvalidEmail, expectedStrict: ErrInvalidEmail},
+		{name: "Local part too long", email: strings.Repeat("a", 65) + "@github.com", expectedStrict: ErrInvalidEmail},
+		{name: "Email too long", email: "john@" + strings.Repeat("a", 63) + "." + strings.Repeat("b", 63) + "." + strings.Repeat("c", 63) + "." + strings.Repeat("d", 60) + ".com", expectedStrict: ErrInvalidEmail},
+		{name: "Leading hyphen label", email: "john@-github.com", expectedStrict: ErrInvalidDomain},
+		{name: "Trailing hyphen label", email: "john@github-.com", expectedStrict: ErrInvalidDomain},
+		{name: "Empty label", email: "john@github..com", expectedStrict: ErrInvalidDomain},
+		{name: "Label too long", email: "john@" + strings.Repeat("a", 64) + ".com", expectedStrict: ErrInvalidDomain},
+		{name: "No top-level domain", email: "john@localhost", expectedLenient: ErrInvalidEmail, expectedStrict: ErrInvalidDomain},
+		{name: "Numeric top-level domain", email: "john@github.123", expectedLenient: ErrInvalidEmail, expectedStrict: ErrInvalidDomain},
+		{name: "Underscore in domain", email: "john@git_hub.com", expectedLenient: ErrInvalidEmail, expectedStrict: ErrInvalidDomain},
+		{name: "Invalid IPv4 literal", email: "root@[192.168.0.256]", expectedLenient: ErrInvalidEmail, expectedStrict: ErrInvalidDomain},
+		{name: "IPv6 literal without tag", email: "root@[2001:db8::1]", expectedLenient: ErrInvalidEmail, expectedStrict: ErrInvalidDomain},
+	}
+
+	validators := []struct {
+		mode     string
+		expected func(tc int) error
+	}{
+		{mode: EmailValidationLenient, expected: func(i int) error { return testCases[i].expectedLenient }},
+		{mode: EmailValidationStrict, expected: func(i int) error { return testCases[i].expectedStrict }},
+	}
+
+	for _, v := range validators {
+		validator, err := NewEmailValidator(v.mode)
+		if err != nil {
+			t.Fatalf("Error creating %s email validator: %v", v.mode, err)
+		}
+
+		for i, tc := range testCases {
+			t.Run(v.mode+" "+tc.name, func(t *testing.T) {
+				// Given
+				localPart, domain, ok := splitEmail(tc.email)
+				if !ok {
+					t.Fatalf("Test %s failed. Can't split %q", tc.name, tc.email)
+				}
+
+				// When
+				err := validator.Validate(localPart, domain)
+
+				// Then
+				expectedErr := v.expected(i)
+				if (err == nil) != (expectedErr == nil) || (expectedErr != nil && !errors.Is(err, expectedErr)) {
+					t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, expectedErr, err)
+				}
+			})
+		}
+	}
+}
+
+func TestSplitEmail(t *testing.T) {
+	testCases := []struct {
+		name              string
+		email             string
+		expectedLocalPart string
+		expectedDomain    string
+		expectedOK        bool
+	}{
+		{name: "OK", email: "john@github.com", expectedLocalPart: "john", expectedDomain: "github.com", expectedOK: true},
+		{name: "Quoted @", email: `"john@home"@github.com`, expectedLocalPart: `"john@home"`, expectedDomain: "github.com", expectedOK: true},
+		{name: "No @", email: "github.com", expectedOK: false},
+		{name: "No local part", email: "@github.com", expectedOK: false},
+		{name: "No domain", email: "john@", expectedOK: false},
+		{name: "Empty string", email: "", expectedOK: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given, When
+			localPart, domain, ok := splitEmail(tc.email)
+
+			// Then
+			if localPart != tc.expectedLocalPart || domain != tc.expectedDomain || ok != tc.expectedOK {
+				t.Errorf("Test %s failed. Expected: %q %q %v, Got: %q %q %v", tc.name, tc.expectedLocalPart, tc.expectedDomain, tc.expectedOK, localPart, domain, ok)
+			}
+		})
+	}
+}
+
+func TestNewEmailValidatorUnknownMode(t *testing.T) {
+	// Given, When
+	validator, err := NewEmailValidator("rfc822")
+
+	// Then
+	if err == nil || validator != nil {
+		t.Errorf("Unexpected result. Expected an error, Got: %v, %v", validator, err)
+	}
+}
+
+// allowListValidator accepts the emails of the given domains only.
+type allowListValidator []string
+
+// Validate rejects the domains missing from the list.
+func (v allowListValidator) Validate(localPart, domain string) error {
+	for _, allowed := range v {
+		if domain == allowed {
+			return nil
+		}
+	}
+	return ErrInvalidDomain
+}
+
+func TestRunReaderEmailValidation(t *testing.T) {
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	input := "email\n" +
+		"john.doe@github.com\n" +
+		"\"\"\"john doe\"\"@github.com\"\n" + // "john doe"@github.com quoted as a CSV field.
+		"john..doe@github.io\n" +
+		"root@[192.168.0.1]\n"
+
+	testCases := []struct {
+		name           string
+		modify         func(config *Config)
+		expectedValue  []DomainCount
+		expectedErrors map[string]int
+	}{
+		{
+			name:           "Lenient",
+			modify:         func(config *Config) { config.EmailValidation = EmailValidationLenient },
+			expectedValue:  []DomainCount{{Domain: "github.com", Count: 1}, {Domain: "github.io", Count: 1}},
+			expectedErrors: map[string]int{ReasonInvalidEmail: 2},
+		},
+		{
+			name:           "Strict",
+			modify:         func(config *Config) { config.EmailValidation = EmailValidationStrict },
+			expectedValue:  []DomainCount{{Domain: "[192.168.0.1]", Count: 1}, {Domain: "github.com", Count: 2}},
+			expectedErrors: map[string]int{ReasonInvalidEmail: 1},
+		},
+		{
+			name:           "Custom validator",
+			modify:         func(config *Config) { config.EmailValidator = allowListValidator{"github.io"} },
+			expectedValue:  []DomainCount{{Domain: "github.io", Count: 1}},
+			expectedErrors: map[string]int{ReasonInvalidDomain: 3},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			validationConfig := *config
+			tc.modify(&validationConfig)
+
+			// When
+			result, err := RunReader(context.Background(), log, &validationConfig, strings.NewReader(input))
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if !reflect.DeepEqual(result.Domains, tc.expectedValue) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, result.Domains)
+			}
+			if !reflect.DeepEqual(result.ErrorsByReason, tc.expectedErrors) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedErrors, result.ErrorsByReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package customerimporter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// DefaultInputEncoding is the encoding of the input used when INPUT_ENCODING isn't set.
+const DefaultInputEncoding = "utf-8"
+
+// Byte order marks of the UTF-16 encoded files.
+var (
+	utf16BEBOM = []byte{0xfe, 0xff}
+	utf16LEBOM = []byte{0xff, 0xfe}
+)
+
+// lookupEncoding returns the encoding of the given name or label, e.g. windows-1252, iso-8859-2 or utf-16le, as
+// defined by the WHATWG Encoding Standard. An empty name stands for UTF-8.
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	if name == "" {
+		return unicode.UTF8, nil
+	}
+
+	enc, err := htmlindex.Get(strings.TrimSpace(name))
+	if err != nil {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+
+	return enc, nil
+}
+
+// decodeInput returns a reader of r decoded from the given encoding into UTF-8. A UTF-16 byte order mark at the start
+// of the input takes precedence over the encoding, so UTF-16 files exported by Excel are decoded without configuring
+// them. UTF-8 input without such a mark is returned as is, without the decoding overhead.
+func decodeInput(r *bufio.Reader, name string, size int) (*bufio.Reader, error) {
+	enc, err := lookupEncoding(name)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, err := r.Peek(len(utf16BEBOM))
+	if err != nil && len(prefix) < len(utf16BEBOM) { // Too short to start with a BOM, reading reports any other error.
+		prefix = nil
+	}
+	utf16 := bytes.Equal(prefix, utf16BEBOM) || bytes.Equal(prefix, utf16LEBOM)
+
+	if enc == unicode.UTF8 && !utf16 {
+		return r, nil
+	}
+
+	// BOMOverride switches to UTF-16 (or UTF-8) when the input starts with their byte order mark, consuming it.
+	decoder := unicode.BOMOverride(enc.NewDecoder())
+	return bufio.NewReaderSize(transform.NewReader(r, decoder), size), nil
+}
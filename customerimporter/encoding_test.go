@@ -0,0 +1,130 @@
+package customerimporter
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestCreateCSVfileReaderEncodings(t *testing.T) {
+	const (
+		polish  = "first_name,last_name,email\nŁucja,Żółkiewska,lucja@onet.pl\n"
+		western = "first_name,last_name,email\nZoë,Brontë,zoe@github.io\n"
+	)
+
+	encode := func(enc encoding.Encoding, input string) string {
+		encoded, err := enc.NewEncoder().String(input)
+		if err != nil {
+			t.Fatalf("Error encoding the input: %v", err)
+		}
+		return encoded
+	}
+
+	testCases := []struct {
+		name          string
+		encoding      string
+		input         string
+		expectedValue []string
+	}{
+		{
+			name:          "UTF-8",
+			encoding:      DefaultInputEncoding,
+			input:         polish,
+			expectedValue: []string{"Łucja", "Żółkiewska", "lucja@onet.pl"},
+		},
+		{
+			name:          "ISO-8859-2",
+			encoding:      "iso-8859-2",
+			input:         encode(charmap.ISO8859_2, polish),
+			expectedValue: []string{"Łucja", "Żółkiewska", "lucja@onet.pl"},
+		},
+		{
+			name:          "Windows-1250 label",
+			encoding:      "CP1250",
+			input:         encode(charmap.Windows1250, polish),
+			expectedValue: []string{"Łucja", "Żółkiewska", "lucja@onet.pl"},
+		},
+		{
+			name:          "Windows-1252",
+			encoding:      "windows-1252",
+			input:         encode(charmap.Windows1252, western),
+			expectedValue: []string{"Zoë", "Brontë", "zoe@github.io"},
+		},
+		{
+			name:          "UTF-16LE detected by the BOM",
+			encoding:      DefaultInputEncoding,
+			input:         encode(unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), polish),
+			expectedValue: []string{"Łucja", "Żółkiewska", "lucja@onet.pl"},
+		},
+		{
+			name:          "UTF-16BE BOM overrides the encoding",
+			encoding:      "windows-1252",
+			input:         encode(unicode.UTF16(unicode.BigEndian, unicode.UseBOM), western),
+			expectedValue: []string{"Zoë", "Brontë", "zoe@github.io"},
+		},
+		{
+			name:          "UTF-16LE without BOM",
+			encoding:      "utf-16le",
+			input:         encode(unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), polish),
+			expectedValue: []string{"Łucja", "Żółkiewska", "lucja@onet.pl"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			log := NewMockLogger()
+			config := &Config{ReadBufferSizeInBytes: DefaultReadBufferSizeInBytes, InputEncoding: tc.encoding}
+
+			// When
+			reader, err := createCSVfileReader(log, config, strings.NewReader(tc.input))
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			defer reader.Close()
+			record, err := reader.Read()
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if !reflect.DeepEqual(record, tc.expectedValue) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, record)
+			}
+			if reader.columns.email != 2 {
+				t.Errorf("Test %s failed. Expected the email column at: %v, Got: %v", tc.name, 2, reader.columns.email)
+			}
+		})
+	}
+}
+
+func TestDecodeInputUTF8Unchanged(t *testing.T) {
+	// Given
+	reader := bufio.NewReader(strings.NewReader("email\n"))
+
+	// When
+	decoded, err := decodeInput(reader, DefaultInputEncoding, DefaultReadBufferSizeInBytes)
+
+	// Then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if decoded != reader {
+		t.Errorf("Unexpected reader. Expected the UTF-8 input to be read as is, Got a decoding reader")
+	}
+}
+
+func TestLookupEncodingUnknown(t *testing.T) {
+	// Given, When
+	enc, err := lookupEncoding("klingon")
+
+	// Then
+	if err == nil || enc != nil {
+		t.Errorf("Unexpected result. Expected an error, Got: %v, %v", enc, err)
+	}
+}
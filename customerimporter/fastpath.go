@@ -0,0 +1,354 @@
+package customerimporter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+	"unsafe"
+)
+
+// csvReaderBufferSize is the size of the buffer of a csv.Reader. It reads from a bufio.Reader at least as large
+// directly, so the data it didn't read yet is still in that bufio.Reader.
+const csvReaderBufferSize = 4096
+
+// maxInternedDomains caps the domains interned by a worker, the domains seen past it are normalized every time.
+const maxInternedDomains = 1 << 16
+
+// fastPathSupported reports whether the rows of the reader can be read by the fast path, which only extracts their
+// email field: not when the filter or the group keys need the other fields, nor with lazy quotes or comment lines,
+// as the rows with quotes are told apart by the quotes alone.
+func fastPathSupported(log Logger, config *Config, reader *csvFileReader) bool {
+	switch {
+	case !config.FastPath:
+		return false
+	case config.Filter != "" || grouped(config.GroupBy):
+		log.Info("The fast path isn't possible with a filter or group keys, they need the other fields of the rows.")
+		return false
+	case reader.LazyQuotes || reader.Comment != 0:
+		log.Info("The fast path isn't possible with lazy quotes or comment lines.")
+		return false
+	case reader.mapped == nil && reader.buffered == nil && len(reader.chunks) == 0:
+		log.Info("The fast path isn't possible with a header line and a read buffer smaller than the CSV reader's one.", "size", csvReaderBufferSize)
+		return false
+	}
+	return true
+}
+
+// fastRow is a row of a fastBatch: its line number and the offsets of its bytes and of its email field in the batch.
+type fastRow struct {
+	line                 int
+	start, end           int
+	emailStart, emailEnd int
+}
+
+// fastBatch holds the rows read by the fast path, copied out of the reader's buffer one after another, or the mapped
+// bytes they are sliced out of when the file is memory-mapped.
+type fastBatch struct {
+	raw    []byte
+	rows   []fastRow
+	mapped bool
+}
+
+// fastBatches recycles the fast batches once the workers are done with them, so reading the rows doesn't allocate.
+var fastBatches = sync.Pool{New: func() any { return new(fastBatch) }}
+
+// getFastBatch returns an empty fast batch from the pool with room for the given number of rows.
+func getFastBatch(batchSize int) *fastBatch {
+	batch := fastBatches.Get().(*fastBatch)
+	if cap(batch.rows) < batchSize {
+		batch.rows = make([]fastRow, 0, batchSize)
+	}
+	return batch
+}
+
+// putFastBatch empties the fast batch and puts it back into the pool. The mapped bytes are read-only, they are let go.
+func putFastBatch(batch *fastBatch) {
+	batch.raw, batch.rows = batch.raw[:0], batch.rows[:0]
+	if batch.mapped {
+		batch.raw, batch.mapped = nil, false
+	}
+	fastBatches.Put(batch)
+}
+
+// record returns the fields of the row, as a csv.Reader would read them.
+func (b *fastBatch) record(row fastRow, comma []byte, trimLeadingSpace bool) []string {
+	return splitFields(b.raw[row.start:row.end], comma, trimLeadingSpace)
+}
+
+// splitFields splits a line without quotes into its fields, as a csv.Reader would.
+func splitFields(line []byte, comma []byte, trimLeadingSpace bool) []string {
+	fields := strings.Split(string(line), string(comma))
+	if trimLeadingSpace {
+		for i := range fields {
+			fields[i] = strings.TrimLeftFunc(fields[i], unicode.IsSpace)
+		}
+	}
+	return fields
+}
+
+// sliceReader reads the data up to a delimiter, like bufio.Reader.ReadSlice.
+type sliceReader interface {
+	ReadSlice(delim byte) ([]byte, error)
+}
+
+// fastScanner reads the rows of a recordSource straight out of its mapped bytes or its buffered reader. The rows
+// without quotes are added to the fast batch of the task along with the offsets of their email field, without
+// splitting them into records: sliced out of the mapped bytes or copied out of the buffer. The rows with quotes are
+// read by a csv.Reader instead, so they are read with the encoding/csv semantics. The worker counting the task puts
+// its fast batch back into the pool.
+type fastScanner struct {
+	r                sliceReader
+	mapped           *mappedReader
+	comma            []byte
+	trimLeadingSpace bool
+	fieldsPerRecord  int
+	emailColumn      int
+	width            int
+	lineOffset       int
+	line             int    // Lines read, relative to the source like the line numbers of its csv.Reader.
+	long             []byte // Line longer than the buffer of the reader.
+	quoted           *lineReader
+	csv              *csv.Reader
+}
+
+// newFastScanner returns the fastScanner of the source, or nil if the source has neither mapped bytes nor a buffered
+// reader to scan.
+func newFastScanner(source recordSource, reader *csvFileReader) *fastScanner {
+	var (
+		r      sliceReader
+		mapped *mappedReader
+	)
+	switch {
+	case source.mapped != nil:
+		mapped = &mappedReader{data: source.mapped}
+		r = mapped
+	case source.buffered != nil:
+		r = source.buffered
+	default:
+		return nil
+	}
+
+	quoted := &lineReader{r: r}
+	csvReader := csv.NewReader(quoted)
+	csvReader.Comma = reader.Comma
+	csvReader.TrimLeadingSpace = reader.TrimLeadingSpace
+
+	return &fastScanner{
+		r:                r,
+		mapped:           mapped,
+		comma:            []byte(string(reader.Comma)),
+		trimLeadingSpace: reader.TrimLeadingSpace,
+		fieldsPerRecord:  source.FieldsPerRecord,
+		emailColumn:      reader.columns.email,
+		width:            reader.columns.width(),
+		lineOffset:       source.lineOffset,
+		line:             source.linesRead,
+		quoted:           quoted,
+		csv:              csvReader,
+	}
+}
+
+// scan reads the next row. A row without quotes holding the mapped columns is added to the fast batch of the task
+// and scan returns a nil record. Any other row is returned as a record along with the line it starts on, like
+// csv.Reader.Read does, including the csv.ParseError of the malformed rows. It returns io.EOF at the end of the data.
+func (s *fastScanner) scan(task *Task) ([]string, int, error) {
+	for {
+		raw, err := s.readLine()
+		if err != nil {
+			return nil, 0, err
+		}
+		if bytes.IndexByte(raw, '"') >= 0 {
+			return s.readQuoted(raw)
+		}
+		s.line++
+
+		// Strip the line break, as a csv.Reader does, and skip the empty lines.
+		line := raw
+		if n := len(line); n > 0 && line[n-1] == '\n' {
+			line = line[:n-1]
+		}
+		if n := len(line); n > 0 && line[n-1] == '\r' { // Either \r\n or a \r before the end of the data.
+			line = line[:n-1]
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		fields := bytes.Count(line, s.comma) + 1
+		if s.fieldsPerRecord == 0 {
+			s.fieldsPerRecord = fields
+		}
+		if s.fieldsPerRecord > 0 && fields != s.fieldsPerRecord {
+			return splitFields(line, s.comma, s.trimLeadingSpace), 0, &csv.ParseError{StartLine: s.line, Line: s.line, Column: 1, Err: csv.ErrFieldCount}
+		}
+		if fields < s.width { // Rejected as a short row by the worker.
+			return splitFields(line, s.comma, s.trimLeadingSpace), s.line, nil
+		}
+
+		emailStart := 0
+		for i := 0; i < s.emailColumn; i++ {
+			emailStart += bytes.Index(line[emailStart:], s.comma) + len(s.comma)
+		}
+		emailEnd := len(line)
+		if i := bytes.Index(line[emailStart:], s.comma); i >= 0 {
+			emailEnd = emailStart + i
+		}
+
+		batch := task.fast
+		start := len(batch.raw)
+		if s.mapped != nil {
+			batch.raw, batch.mapped = s.mapped.data, true
+			start = s.mapped.offset - len(raw)
+		} else {
+			batch.raw = append(batch.raw, line...)
+		}
+		batch.rows = append(batch.rows, fastRow{
+			line:       s.lineOffset + s.line,
+			start:      start,
+			end:        start + len(line),
+			emailStart: start + emailStart,
+			emailEnd:   start + emailEnd,
+		})
+		return nil, 0, nil
+	}
+}
+
+// readLine returns the next line along with its line break, if any. It is valid until the next read.
+func (s *fastScanner) readLine() ([]byte, error) {
+	line, err := s.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		s.long = append(s.long[:0], line...)
+		for err == bufio.ErrBufferFull {
+			line, err = s.r.ReadSlice('\n')
+			s.long = append(s.long, line...)
+		}
+		line = s.long
+	}
+
+	if len(line) > 0 && err == io.EOF { // The last line, without a line break.
+		return line, nil
+	}
+	return line, err
+}
+
+// readQuoted reads the record starting with the line with quotes by the csv.Reader, which reads the lines of the
+// record that follow it, if any, from the buffered reader. The line numbers of the csv.Reader are those of the lines
+// it read, they are turned into the lines of the source.
+func (s *fastScanner) readQuoted(raw []byte) ([]string, int, error) {
+	linesBefore := s.quoted.lines
+	offset := s.line - linesBefore
+	s.quoted.feed(raw)
+
+	s.csv.FieldsPerRecord = s.fieldsPerRecord
+	record, err := s.csv.Read()
+	s.fieldsPerRecord = s.csv.FieldsPerRecord
+	s.line += s.quoted.lines - linesBefore
+
+	if parseErr, ok := err.(*csv.ParseError); ok {
+		parseErr.StartLine += offset
+		parseErr.Line += offset
+	}
+	if err != nil {
+		return record, 0, err
+	}
+
+	line, _ := s.csv.FieldPos(0)
+	return record, offset + line, nil
+}
+
+// lineReader feeds a csv.Reader the lines of a buffered reader, never reading past the line break of the line it
+// asks for, so the rows following its record are left to the fastScanner.
+type lineReader struct {
+	r       sliceReader
+	pending []byte
+	lines   int  // Lines started.
+	midLine bool // The last bytes fed didn't end with a line break.
+}
+
+// feed sets the bytes returned by the next reads, up to a line break.
+func (l *lineReader) feed(b []byte) {
+	if !l.midLine {
+		l.lines++
+	}
+	l.midLine = b[len(b)-1] != '\n'
+	l.pending = b
+}
+
+// Read reads the rest of the line fed last, if any, or the next line of the buffered reader.
+func (l *lineReader) Read(p []byte) (int, error) {
+	if len(l.pending) == 0 {
+		line, err := l.r.ReadSlice('\n')
+		if len(line) == 0 {
+			return 0, err
+		}
+		l.feed(line)
+	}
+
+	n := copy(p, l.pending)
+	l.pending = l.pending[n:]
+	return n, nil
+}
+
+// fastEmails splits the emails of the fast batches and validates them, the way the workers do with the records. The
+// normalized domains are interned, so the emails of a domain seen before are counted without allocating.
+type fastEmails struct {
+	validator EmailValidator
+	clone     bool // The validator is set in code and may keep the local parts, they are copied out of the batch.
+	domains   map[string]internedDomain
+}
+
+// internedDomain is the normalized form of a domain as written in the emails, ok unless it can't be normalized.
+type internedDomain struct {
+	domain string
+	ok     bool
+}
+
+// newFastEmails returns a fastEmails validating the emails with the given validator.
+func newFastEmails(validator EmailValidator) *fastEmails {
+	var clone bool
+	switch validator.(type) {
+	case lenientEmailValidator, strictEmailValidator: // Don't keep the local parts.
+	default:
+		clone = true
+	}
+	return &fastEmails{validator: validator, clone: clone, domains: make(map[string]internedDomain)}
+}
+
+// split returns the local part and the normalized domain of the email of the row. The local part is only valid
+// until the batch is recycled, unless the validator is set in code. It returns false if the email is rejected, the
+// row is then handled as a record, so it is rejected for the same reason as any other.
+func (f *fastEmails) split(batch *fastBatch, row fastRow) (localPart, domain string, ok bool) {
+	email := bytes.TrimSpace(batch.raw[row.emailStart:row.emailEnd])
+	at := bytes.LastIndexByte(email, '@')
+	if at <= 0 || at == len(email)-1 {
+		return "", "", false
+	}
+
+	rawDomain := email[at+1:]
+	interned, found := f.domains[string(rawDomain)] // Doesn't allocate.
+	if !found {
+		normalized, err := normalizeDomain(string(rawDomain))
+		interned = internedDomain{domain: normalized, ok: err == nil}
+		if len(f.domains) < maxInternedDomains {
+			f.domains[string(rawDomain)] = interned
+		}
+	}
+	if !interned.ok {
+		return "", "", false
+	}
+
+	// The local part points into the batch instead of being copied, the built-in validators don't keep it.
+	localPart = unsafe.String(unsafe.SliceData(email), at)
+	if f.clone {
+		localPart = strings.Clone(localPart)
+	}
+	if err := f.validator.Validate(localPart, interned.domain); err != nil {
+		return "", "", false
+	}
+
+	return localPart, interned.domain, true
+}
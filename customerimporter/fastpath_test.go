@@ -0,0 +1,240 @@
+package customerimporter
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// scannedRow is a row read by a fastScanner or a csv.Reader.
+type scannedRow struct {
+	Line   int
+	Record []string
+	Err    error
+}
+
+func TestFastScanner(t *testing.T) {
+	testCases := []struct {
+		name             string
+		data             string
+		comma            rune
+		trimLeadingSpace bool
+		fieldsPerRecord  int
+		bufferSize       int
+	}{
+		{
+			name: "Rows without quotes",
+			data: "Mildred,Hernandez,mhernandez0@github.io,Female,38.194.51.128\nBonnie,Ortiz,bortiz1@cyberchimps.com,Female,197.54.209.129\n",
+		},
+		{
+			name: "Line breaks and empty lines",
+			data: "Mildred,Hernandez,mhernandez0@github.io,Female,38.194.51.128\r\n\r\n\nBonnie,Ortiz,bortiz1@cyberchimps.com,Female,197.54.209.129\r",
+		},
+		{
+			name: "Quoted fields with line breaks and doubled quotes",
+			data: "\"Mildred\n\"\"Milly\"\"\",\"Hernandez,\r\nJr.\",mhernandez0@github.io,Female,38.194.51.128\nBonnie,Ortiz,bortiz1@cyberchimps.com,Female,197.54.209.129\n\"Dennis\",Henry,dhenry2@hubpages.com,Male,155.75.186.217",
+		},
+		{
+			name: "Malformed rows",
+			data: "Mildred,Her\"nandez,mhernandez0@github.io,Female,38.194.51.128\nBonnie,Ortiz,bortiz1@cyberchimps.com,Female\nDennis,Henry,dhenry2@hubpages.com,Male,155.75.186.217\n\"Dennis,Henry,dhenry2@hubpages.com,Male,155.75.186.217\n",
+		},
+		{
+			name:            "Variable number of fields",
+			data:            "Bonnie,Ortiz,bortiz1@cyberchimps.com\nDennis,Henry,dhenry2@hubpages.com,Male,155.75.186.217,extra\n",
+			fieldsPerRecord: -1,
+		},
+		{
+			name:             "Delimiter and leading spaces",
+			data:             "Mildred; Hernandez;  mhernandez0@github.io ;Female;38.194.51.128\nBonnie;Ortiz; \"bortiz1@cyberchimps.com\";Female;197.54.209.129\n",
+			comma:            ';',
+			trimLeadingSpace: true,
+		},
+		{
+			name:       "Lines longer than the buffer",
+			data:       "Mildred,Hernandez,mhernandez0@github.io,Female,38.194.51.128\n\"Bonnie\",Ortiz,bortiz1@cyberchimps.com,Female,197.54.209.129\n",
+			bufferSize: 16,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			comma := delimiterOrDefault(tc.comma)
+			bufferSize := csvReaderBufferSize
+			if tc.bufferSize > 0 {
+				bufferSize = tc.bufferSize
+			}
+
+			expected := readRows(t, tc.data, comma, tc.trimLeadingSpace, tc.fieldsPerRecord)
+
+			csvReader := csv.NewReader(strings.NewReader(tc.data))
+			csvReader.Comma, csvReader.TrimLeadingSpace, csvReader.FieldsPerRecord = comma, tc.trimLeadingSpace, tc.fieldsPerRecord
+			reader := &csvFileReader{Reader: csvReader, columns: defaultColumnMapping()}
+			source := recordSource{Reader: csvReader, buffered: bufio.NewReaderSize(strings.NewReader(tc.data), bufferSize)}
+
+			// When
+			scanner := newFastScanner(source, reader)
+			var rows []scannedRow
+			for {
+				task := newTask(1, true)
+				record, line, err := scanner.scan(&task)
+				if err == io.EOF {
+					break
+				}
+				if record == nil && err == nil {
+					row := task.fast.rows[0]
+					record, line = task.fast.record(row, scanner.comma, tc.trimLeadingSpace), row.line
+				}
+				rows = append(rows, scannedRow{Line: line, Record: record, Err: err})
+			}
+
+			// Then
+			if !reflect.DeepEqual(rows, expected) {
+				t.Errorf("Test %s failed. Expected: %+v, Got: %+v", tc.name, expected, rows)
+			}
+		})
+	}
+}
+
+// readRows reads the rows of the data with a csv.Reader.
+func readRows(t *testing.T, data string, comma rune, trimLeadingSpace bool, fieldsPerRecord int) []scannedRow {
+	t.Helper()
+
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.Comma, reader.TrimLeadingSpace, reader.FieldsPerRecord = comma, trimLeadingSpace, fieldsPerRecord
+
+	var rows []scannedRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows
+		}
+		line := 0
+		if err == nil {
+			line, _ = reader.FieldPos(0)
+		}
+		rows = append(rows, scannedRow{Line: line, Record: record, Err: err})
+	}
+}
+
+func TestFastScannerAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("The pools of the regular expressions drop items with the race detector.")
+	}
+
+	// Given
+	data := strings.Repeat("Mildred,Hernandez,mhernandez0@github.io,Female,38.194.51.128\n", 2000)
+	csvReader := csv.NewReader(strings.NewReader(data))
+	reader := &csvFileReader{Reader: csvReader, columns: defaultColumnMapping()}
+	scanner := newFastScanner(recordSource{Reader: csvReader, buffered: bufio.NewReader(strings.NewReader(data))}, reader)
+	task := Task{fast: &fastBatch{raw: make([]byte, 0, len(data)), rows: make([]fastRow, 0, 2000)}}
+	emails := newFastEmails(lenientEmailValidator{})
+
+	// When
+	scanAllocs := testing.AllocsPerRun(1000, func() {
+		if _, _, err := scanner.scan(&task); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+	splitAllocs := testing.AllocsPerRun(1000, func() {
+		if _, _, ok := emails.split(task.fast, task.fast.rows[0]); !ok {
+			t.Fatalf("Unexpected rejected email")
+		}
+	})
+
+	// Then
+	if scanAllocs != 0 || splitAllocs != 0 {
+		t.Errorf("Unexpected allocations. Expected: 0 per row, Got: %v per scanned row, %v per split email", scanAllocs, splitAllocs)
+	}
+}
+
+func TestRunFastPath(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	config.Concurrency = 4
+	config.WriteRejects = true
+	config.Dedup = true
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "customers.csv")
+	writeChunkedTestFile(t, path)
+
+	run := func(t *testing.T, config *Config) (*Result, []string) {
+		t.Helper()
+
+		result, err := Run(context.Background(), log, withInput(config, path))
+		if err != nil {
+			t.Fatalf("Error running the import: %v", err)
+		}
+
+		rejected, err := os.ReadFile(filepath.Join(dir, "customers.rejects.csv"))
+		if err != nil {
+			t.Fatalf("Error reading the rejects file: %v", err)
+		}
+		rejects := strings.Split(string(rejected), "\n")
+		sort.Strings(rejects) // The rejects of the batches are written in any order.
+		return result, rejects
+	}
+	expectedResult, expectedRejects := run(t, config)
+
+	for _, mode := range ReaderModes {
+		t.Run(mode, func(t *testing.T) {
+			config := *config
+			config.ReaderMode = mode
+			config.FastPath = true
+
+			// When
+			result, rejects := run(t, &config)
+
+			// Then
+			if !reflect.DeepEqual(result.Domains, expectedResult.Domains) || !reflect.DeepEqual(result.Stats, expectedResult.Stats) || result.UniqueCustomers != expectedResult.UniqueCustomers {
+				t.Errorf("Unexpected fast path result. Expected: %+v, Got: %+v", expectedResult.Stats, result.Stats)
+			}
+			if !reflect.DeepEqual(rejects, expectedRejects) {
+				t.Errorf("Unexpected fast path rejects. Expected: %d lines, Got: %d lines", len(expectedRejects), len(rejects))
+			}
+		})
+	}
+}
+
+// keepingValidator is an EmailValidator set in code which keeps the local parts it validates.
+type keepingValidator struct {
+	localParts *[]string
+}
+
+// Validate keeps the local part and accepts the email.
+func (v keepingValidator) Validate(localPart, domain string) error {
+	*v.localParts = append(*v.localParts, localPart)
+	return nil
+}
+
+func TestFastEmailsCustomValidator(t *testing.T) {
+	// Given
+	var localParts []string
+	emails := newFastEmails(keepingValidator{localParts: &localParts})
+	batch := &fastBatch{raw: []byte("mhernandez0@github.io")}
+	row := fastRow{end: len(batch.raw), emailEnd: len(batch.raw)}
+
+	// When
+	if _, _, ok := emails.split(batch, row); !ok {
+		t.Fatalf("Unexpected rejected email")
+	}
+	copy(batch.raw, "xxxxxxxxxxx") // The batch is recycled and reused.
+
+	// Then
+	expected := []string{"mhernandez0"}
+	if !reflect.DeepEqual(localParts, expected) {
+		t.Errorf("Unexpected kept local parts. Expected: %v, Got: %v", expected, localParts)
+	}
+}
@@ -0,0 +1,496 @@
+package customerimporter
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Fields of the customers the filters can test. Besides the Customer fields, FilterFieldDomain is the normalized
+// domain of the email.
+const FilterFieldDomain = "domain"
+
+// filterFields lists the fields the filters can test.
+var filterFields = append(append([]string{}, customerFields...), FilterFieldDomain)
+
+// filterRow is what a filter is evaluated against: the customer along with the normalized domain of the email.
+type filterRow struct {
+	customer *Customer
+	domain   string
+}
+
+// field returns the value of the field of the row, without its surrounding whitespace.
+func (r filterRow) field(name string) string {
+	switch name {
+	case FieldFirstName:
+		return strings.TrimSpace(r.customer.FirstName)
+	case FieldLastName:
+		return strings.TrimSpace(r.customer.LastName)
+	case FieldEmail:
+		return strings.TrimSpace(r.customer.Email)
+	case FieldGender:
+		return strings.TrimSpace(r.customer.Gender)
+	case FieldIPAddress:
+		return strings.TrimSpace(r.customer.IPAddress)
+	default:
+		return r.domain
+	}
+}
+
+// filter is a compiled filter expression. It is immutable, so the workers evaluate it concurrently.
+type filter interface {
+	match(row filterRow) bool
+}
+
+// compileFilter compiles the filter expression, e.g. `gender == Female and not ip_address in 10.0.0.0/8`, or returns
+// nil if the expression is empty. The grammar is:
+//
+//	expression = term { "or" term }
+//	term       = factor { "and" factor }
+//	factor     = "not" factor | "(" expression ")" | comparison
+//	comparison = field ( "==" | "!=" | "<" | "<=" | ">" | ">=" | "=~" | "!~" ) value
+//	           | field [ "not" ] "in" ( value | "(" value { "," value } ")" )
+//
+// The values are either bare words, e.g. Female or 10.0.0.0/8, or quoted strings with Go escapes. The keywords are
+// case-insensitive.
+func compileFilter(expression string) (filter, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, nil
+	}
+
+	tokens, err := lexFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	f, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.kind != filterTokenEOF {
+		return nil, fmt.Errorf("unexpected %s at offset %d", token, token.offset)
+	}
+
+	return f, nil
+}
+
+// Kinds of the filter tokens.
+const (
+	filterTokenEOF = iota
+	filterTokenWord
+	filterTokenString
+	filterTokenOperator
+	filterTokenPunct // Parentheses and commas.
+)
+
+// filterToken is a token of a filter expression.
+type filterToken struct {
+	kind   int
+	text   string // The unquoted text of strings.
+	offset int    // Byte offset of the token in the expression, for the error messages.
+}
+
+// String returns the token as it is reported in the error messages.
+func (t filterToken) String() string {
+	if t.kind == filterTokenEOF {
+		return "end of the filter"
+	}
+	return strconv.Quote(t.text)
+}
+
+// is reports whether the token is the given punctuation, operator or (case-insensitive) keyword.
+func (t filterToken) is(text string) bool {
+	if t.kind == filterTokenWord {
+		return strings.EqualFold(t.text, text)
+	}
+	return (t.kind == filterTokenOperator || t.kind == filterTokenPunct) && t.text == text
+}
+
+// filterOperators lists the comparison operators, the two-character ones first.
+var filterOperators = []string{"==", "!=", "<=", ">=", "=~", "!~", "<", ">"}
+
+// lexFilter splits the filter expression into tokens.
+func lexFilter(expression string) ([]filterToken, error) {
+	var tokens []filterToken
+
+	for offset := 0; offset < len(expression); {
+		r, size := utf8.DecodeRuneInString(expression[offset:])
+		switch {
+		case unicode.IsSpace(r):
+			offset += size
+
+		case r == '(' || r == ')' || r == ',':
+			tokens = append(tokens, filterToken{kind: filterTokenPunct, text: string(r), offset: offset})
+			offset += size
+
+		case r == '"' || r == '\'':
+			text, length, err := unquoteFilterString(expression[offset:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d: %w", offset, err)
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenString, text: text, offset: offset})
+			offset += length
+
+		case strings.ContainsRune("=!<>", r):
+			operator := ""
+			for _, candidate := range filterOperators {
+				if strings.HasPrefix(expression[offset:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unknown operator at offset %d, expected one of %q", offset, filterOperators)
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenOperator, text: operator, offset: offset})
+			offset += len(operator)
+
+		default:
+			end := offset
+			for end < len(expression) {
+				r, size := utf8.DecodeRuneInString(expression[end:])
+				if unicode.IsSpace(r) || strings.ContainsRune(`(),"'=!<>`, r) {
+					break
+				}
+				end += size
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenWord, text: expression[offset:end], offset: offset})
+			offset = end
+		}
+	}
+
+	return append(tokens, filterToken{kind: filterTokenEOF, offset: len(expression)}), nil
+}
+
+// unquoteFilterString returns the unquoted text of the string at the start of s, quoted by " or ', along with the
+// length of the quoted string.
+func unquoteFilterString(s string) (string, int, error) {
+	quote := s[0]
+	for end := 1; end < len(s); end++ {
+		switch s[end] {
+		case '\\':
+			end++ // Skip the escaped character.
+		case quote:
+			body := s[1:end]
+			if quote == '\'' { // Go quotes single characters only with ', requote the string with ".
+				body = requoteFilterString(body)
+			}
+			text, err := strconv.Unquote(`"` + body + `"`)
+			return text, end + 1, err
+		}
+	}
+	return "", 0, fmt.Errorf("missing closing %c", quote)
+}
+
+// requoteFilterString turns the body of a string quoted by ' into the body of a string quoted by ".
+func requoteFilterString(body string) string {
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		switch {
+		case body[i] == '\\' && i+1 < len(body) && body[i+1] == '\'':
+			b.WriteByte('\'')
+			i++
+		case body[i] == '\\' && i+1 < len(body):
+			b.WriteString(body[i : i+2])
+			i++
+		case body[i] == '"':
+			b.WriteString(`\"`)
+		default:
+			b.WriteByte(body[i])
+		}
+	}
+	return b.String()
+}
+
+// filterParser parses the tokens of a filter expression into a filter by recursive descent.
+type filterParser struct {
+	tokens   []filterToken
+	position int
+}
+
+// peek returns the next token without consuming it.
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.position]
+}
+
+// next consumes and returns the next token. The last token, the end of the filter, is never consumed.
+func (p *filterParser) next() filterToken {
+	token := p.tokens[p.position]
+	if token.kind != filterTokenEOF {
+		p.position++
+	}
+	return token
+}
+
+// expression parses terms joined by "or".
+func (p *filterParser) expression() (filter, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().is("or") {
+		p.next()
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = orFilter{left, right}
+	}
+
+	return left, nil
+}
+
+// term parses factors joined by "and".
+func (p *filterParser) term() (filter, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().is("and") {
+		p.next()
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = andFilter{left, right}
+	}
+
+	return left, nil
+}
+
+// factor parses a negation, an expression in parentheses or a comparison.
+func (p *filterParser) factor() (filter, error) {
+	switch token := p.peek(); {
+	case token.is("not"):
+		p.next()
+		f, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{f}, nil
+
+	case token.is("("):
+		p.next()
+		f, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if token := p.next(); !token.is(")") {
+			return nil, fmt.Errorf("expected \")\" at offset %d, got %s", token.offset, token)
+		}
+		return f, nil
+
+	default:
+		return p.comparison()
+	}
+}
+
+// comparison parses a field compared to a value or tested for membership of a list of values.
+func (p *filterParser) comparison() (filter, error) {
+	token := p.next()
+	field := strings.ToLower(token.text)
+	if token.kind != filterTokenWord || !slices.Contains(filterFields, field) {
+		return nil, fmt.Errorf("expected a field at offset %d, got %s, the fields are %q", token.offset, token, filterFields)
+	}
+
+	operator := p.next()
+	negated := false
+	if operator.is("not") {
+		negated, operator = true, p.next()
+		if !operator.is("in") {
+			return nil, fmt.Errorf("expected \"in\" at offset %d, got %s", operator.offset, operator)
+		}
+	}
+
+	if operator.is("in") {
+		values, err := p.values()
+		if err != nil {
+			return nil, err
+		}
+		var f filter = newInFilter(field, values)
+		if negated {
+			f = notFilter{f}
+		}
+		return f, nil
+	}
+
+	if operator.kind != filterTokenOperator {
+		return nil, fmt.Errorf("expected an operator at offset %d, got %s, the operators are %q and \"in\"", operator.offset, operator, filterOperators)
+	}
+
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+
+	switch operator.text {
+	case "=~", "!~":
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression at offset %d: %w", operator.offset, err)
+		}
+		return regexpFilter{field: field, pattern: pattern, negated: operator.text == "!~"}, nil
+	default:
+		return compareFilter{field: field, operator: operator.text, value: value}, nil
+	}
+}
+
+// values parses a single value or a list of values in parentheses.
+func (p *filterParser) values() ([]string, error) {
+	if !p.peek().is("(") {
+		value, err := p.value()
+		return []string{value}, err
+	}
+	p.next()
+
+	var values []string
+	for {
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		switch token := p.next(); {
+		case token.is(")"):
+			return values, nil
+		case !token.is(","):
+			return nil, fmt.Errorf("expected \",\" or \")\" at offset %d, got %s", token.offset, token)
+		}
+	}
+}
+
+// value parses a bare word or a quoted string.
+func (p *filterParser) value() (string, error) {
+	token := p.next()
+	if token.kind != filterTokenWord && token.kind != filterTokenString {
+		return "", fmt.Errorf("expected a value at offset %d, got %s", token.offset, token)
+	}
+	return token.text, nil
+}
+
+// andFilter matches the rows both filters match.
+type andFilter struct{ left, right filter }
+
+func (f andFilter) match(row filterRow) bool { return f.left.match(row) && f.right.match(row) }
+
+// orFilter matches the rows any of the filters matches.
+type orFilter struct{ left, right filter }
+
+func (f orFilter) match(row filterRow) bool { return f.left.match(row) || f.right.match(row) }
+
+// notFilter matches the rows the filter doesn't match.
+type notFilter struct{ filter filter }
+
+func (f notFilter) match(row filterRow) bool { return !f.filter.match(row) }
+
+// compareFilter compares a field to a value. Equality ignores the case, the order is numeric when both the field and
+// the value are numbers and lexicographic otherwise.
+type compareFilter struct {
+	field    string
+	operator string
+	value    string
+}
+
+func (f compareFilter) match(row filterRow) bool {
+	field := row.field(f.field)
+
+	switch f.operator {
+	case "==":
+		return strings.EqualFold(field, f.value)
+	case "!=":
+		return !strings.EqualFold(field, f.value)
+	}
+
+	order := strings.Compare(field, f.value)
+	if a, err := strconv.ParseFloat(field, 64); err == nil {
+		if b, err := strconv.ParseFloat(f.value, 64); err == nil {
+			order = compareFloats(a, b)
+		}
+	}
+
+	switch f.operator {
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	default:
+		return order >= 0
+	}
+}
+
+// compareFloats returns -1, 0 or 1 as a is less than, equal to or greater than b.
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// regexpFilter matches the rows whose field matches (or doesn't match, when negated) the regular expression.
+type regexpFilter struct {
+	field   string
+	pattern *regexp.Regexp
+	negated bool
+}
+
+func (f regexpFilter) match(row filterRow) bool {
+	return f.pattern.MatchString(row.field(f.field)) != f.negated
+}
+
+// inFilter matches the rows whose field is one of the values, ignoring the case, or an IP address in one of the
+// networks given in CIDR notation, e.g. 10.0.0.0/8.
+type inFilter struct {
+	field    string
+	values   map[string]struct{} // Lowercased values.
+	prefixes []netip.Prefix
+}
+
+// newInFilter returns the inFilter of the field and the values, parsing the values in CIDR notation as networks.
+func newInFilter(field string, values []string) inFilter {
+	f := inFilter{field: field, values: make(map[string]struct{}, len(values))}
+	for _, value := range values {
+		if prefix, err := netip.ParsePrefix(value); err == nil {
+			f.prefixes = append(f.prefixes, prefix.Masked())
+			continue
+		}
+		f.values[strings.ToLower(value)] = struct{}{}
+	}
+	return f
+}
+
+func (f inFilter) match(row filterRow) bool {
+	field := row.field(f.field)
+	if _, ok := f.values[strings.ToLower(field)]; ok {
+		return true
+	}
+
+	if len(f.prefixes) == 0 {
+		return false
+	}
+	ip, err := netip.ParseAddr(field)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap().WithZone("")
+	for _, prefix := range f.prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package customerimporter
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompileFilter(t *testing.T) {
+	row := filterRow{
+		customer: &Customer{FirstName: "Mildred", LastName: "O'Hara", Email: "mhernandez0@GitHub.io", Gender: "Female", IPAddress: " 10.1.2.3 "},
+		domain:   "github.io",
+	}
+
+	testCases := []struct {
+		name          string
+		expression    string
+		expectedValue bool
+	}{
+		{name: "Equality ignores the case", expression: "gender == female", expectedValue: true},
+		{name: "Inequality", expression: "gender != Female", expectedValue: false},
+		{name: "Quoted value", expression: `last_name == "o'hara"`, expectedValue: true},
+		{name: "Single-quoted value with escapes", expression: `last_name == 'O\'Hara'`, expectedValue: true},
+		{name: "Lexicographic order", expression: "first_name < N", expectedValue: true},
+		{name: "Lexicographic order of non-numbers", expression: "ip_address > 9", expectedValue: false},
+		{name: "In list", expression: "domain in (github.com, GITHUB.IO)", expectedValue: true},
+		{name: "Not in list", expression: "domain not in (github.com, github.io)", expectedValue: false},
+		{name: "In CIDR", expression: "ip_address in 10.0.0.0/8", expectedValue: true},
+		{name: "In CIDR list", expression: "ip_address in (192.168.0.0/16, 2001:db8::/32)", expectedValue: false},
+		{name: "Regular expression", expression: `email =~ "(?i)^mh.*@github\\.io$"`, expectedValue: true},
+		{name: "Negated regular expression", expression: "email !~ ^mh", expectedValue: false},
+		{name: "And binds tighter than or", expression: "gender == Male and domain == github.io or first_name == Mildred", expectedValue: true},
+		{name: "Parentheses", expression: "gender == Male and (domain == github.io or first_name == Mildred)", expectedValue: false},
+		{name: "Not", expression: "NOT gender == Male AND not not domain == github.io", expectedValue: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			filter, err := compileFilter(tc.expression)
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+
+			// When
+			match := filter.match(row)
+
+			// Then
+			if match != tc.expectedValue {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, match)
+			}
+		})
+	}
+}
+
+func TestCompareFilterNumbers(t *testing.T) {
+	// Given
+	row := filterRow{customer: &Customer{FirstName: "9"}}
+	filter := compareFilter{field: FieldFirstName, operator: "<", value: "10.5"}
+
+	// When
+	match := filter.match(row)
+
+	// Then
+	if !match {
+		t.Errorf("Unexpected result. Expected 9 < 10.5 as numbers, Got: %v", match)
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		expression  string
+		expectedErr string
+	}{
+		{name: "Unknown field", expression: "age > 30", expectedErr: `expected a field at offset 0, got "age"`},
+		{name: "Unknown operator", expression: "gender = Female", expectedErr: "unknown operator at offset 7"},
+		{name: "Missing value", expression: "gender ==", expectedErr: "expected a value at offset 9, got end of the filter"},
+		{name: "Missing parenthesis", expression: "(gender == Female", expectedErr: `expected ")" at offset 17`},
+		{name: "Unterminated list", expression: "domain in (a, b", expectedErr: `expected "," or ")" at offset 15`},
+		{name: "Not without in", expression: "domain not a", expectedErr: `expected "in" at offset 11`},
+		{name: "Unterminated string", expression: `gender == "Female`, expectedErr: "missing closing \""},
+		{name: "Invalid regular expression", expression: "email =~ (", expectedErr: "expected a value at offset 9"},
+		{name: "Invalid regular expression pattern", expression: `email =~ "a("`, expectedErr: "invalid regular expression at offset 6"},
+		{name: "Trailing tokens", expression: "gender == Female Male", expectedErr: `unexpected "Male" at offset 17`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given, When
+			_, err := compileFilter(tc.expression)
+
+			// Then
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestRunFilter(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	config.InputCSVFilePathDefault = config.InputCSVFilePath10Lines
+	config.Filter = "gender == Female and not ip_address in 38.0.0.0/8"
+
+	// When
+	result, err := Run(context.Background(), log, config)
+
+	// Then
+	if err != nil {
+		t.Fatalf("Error running import: %v", err)
+	}
+
+	expectedDomains := []DomainCount{{Domain: "cnet.com", Count: 1}, {Domain: "github.com", Count: 1}}
+	if !reflect.DeepEqual(result.Domains, expectedDomains) {
+		t.Errorf("Unexpected domains. Expected: %v, Got: %v", expectedDomains, result.Domains)
+	}
+	if result.RowsRead != 9 || result.RowsFiltered != 7 || result.RowsRejected != 0 {
+		t.Errorf("Unexpected stats. Expected: 9 read, 7 filtered, 0 rejected, Got: %+v", result.Stats)
+	}
+}
@@ -0,0 +1,175 @@
+package customerimporter
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Keys the customers can be grouped by. Besides them, column:<name> groups by the value of any named column of the
+// header, e.g. column:country.
+const (
+	GroupKeyDomain      = "domain"       // Email domain, aggregated and formatted as configured.
+	GroupKeyGender      = "gender"       // Gender as it is written.
+	GroupKeyIPPrefix    = "ip_prefix"    // The /24 network of the IPv4 addresses and the /48 network of the IPv6 ones.
+	GroupKeyLastInitial = "last_initial" // Uppercased first letter of the last name.
+	GroupKeyColumn      = "column:"
+)
+
+// GroupKeys lists the supported group keys.
+var GroupKeys = []string{GroupKeyDomain, GroupKeyGender, GroupKeyIPPrefix, GroupKeyLastInitial, GroupKeyColumn + "<name>"}
+
+// groupKeySeparator separates the values of a composite key in the maps of counts. It sorts before any printable
+// character, so composite keys are ordered by their first value, then by their second one and so on.
+const groupKeySeparator = "\x1f"
+
+// Lengths of the IP address prefixes grouped by GroupKeyIPPrefix.
+const (
+	ipv4PrefixBits = 24
+	ipv6PrefixBits = 48
+)
+
+// validateGroupBy returns an error if any of the group keys isn't supported or can't be combined with the domain
+// aggregation.
+func validateGroupBy(keys []string, aggregation string) error {
+	for _, key := range keys {
+		switch {
+		case key == GroupKeyDomain, key == GroupKeyGender, key == GroupKeyIPPrefix, key == GroupKeyLastInitial:
+		case strings.HasPrefix(key, GroupKeyColumn) && strings.TrimSpace(key[len(GroupKeyColumn):]) != "":
+		default:
+			return fmt.Errorf("unknown group key %q, expected any of %q", key, GroupKeys)
+		}
+	}
+
+	if grouped(keys) && aggregation == AggregationBoth {
+		return fmt.Errorf("grouping by %q can't report both the registrable and the exact domains", keys)
+	}
+
+	return nil
+}
+
+// grouped reports whether the customers are grouped by other keys than the domain alone.
+func grouped(keys []string) bool {
+	return len(keys) > 1 || len(keys) == 1 && keys[0] != GroupKeyDomain
+}
+
+// grouper computes the composite key of the customers, the values of the group keys joined by groupKeySeparator.
+type grouper struct {
+	keys    []string
+	columns []int // Position of the named columns in the records, -1 for the other keys.
+	config  *Config
+}
+
+// newGrouper returns the grouper of the config's group keys, resolving the named columns in the header, or nil if the
+// customers are grouped by domain alone. It fails when a named column isn't in the header.
+func newGrouper(config *Config, header []string) (*grouper, error) {
+	if !grouped(config.GroupBy) {
+		return nil, nil
+	}
+
+	columns := make([]int, len(config.GroupBy))
+	for i, key := range config.GroupBy {
+		columns[i] = -1
+		if !strings.HasPrefix(key, GroupKeyColumn) {
+			continue
+		}
+
+		name := normalizeColumnName(key[len(GroupKeyColumn):])
+		for position, column := range header {
+			if normalizeColumnName(column) == name {
+				columns[i] = position
+				break
+			}
+		}
+		if columns[i] == -1 {
+			return nil, fmt.Errorf("group key %q: column not found in the CSV header %q", key, header)
+		}
+	}
+
+	return &grouper{keys: config.GroupBy, columns: columns, config: config}, nil
+}
+
+// key returns the composite key of the customer read from the record, whose email has the given normalized domain.
+// Missing or unparsable values, e.g. a malformed IP address, are grouped under an empty value.
+func (g *grouper) key(record []string, customer *Customer, domain string) string {
+	var b strings.Builder
+	for i, key := range g.keys {
+		if i > 0 {
+			b.WriteString(groupKeySeparator)
+		}
+
+		switch key {
+		case GroupKeyDomain:
+			b.WriteString(aggregationKey(domain, g.config))
+		case GroupKeyGender:
+			b.WriteString(strings.TrimSpace(customer.Gender))
+		case GroupKeyIPPrefix:
+			b.WriteString(ipPrefix(customer.IPAddress))
+		case GroupKeyLastInitial:
+			b.WriteString(initial(customer.LastName))
+		default:
+			if position := g.columns[i]; position < len(record) {
+				b.WriteString(strings.TrimSpace(record[position]))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// ipPrefix returns the /24 network of the IPv4 address or the /48 network of the IPv6 address, e.g. 38.194.51.0/24,
+// or an empty string if it isn't a valid address. IPv4-mapped IPv6 addresses are treated as IPv4 ones.
+func ipPrefix(address string) string {
+	ip, err := netip.ParseAddr(strings.TrimSpace(address))
+	if err != nil {
+		return ""
+	}
+
+	ip = ip.Unmap().WithZone("")
+	bits := ipv6PrefixBits
+	if ip.Is4() {
+		bits = ipv4PrefixBits
+	}
+
+	prefix, err := ip.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
+}
+
+// initial returns the uppercased first letter of the name, or an empty string if the name is empty.
+func initial(name string) string {
+	first, size := utf8.DecodeRuneInString(strings.TrimSpace(name))
+	if size == 0 {
+		return ""
+	}
+	return string(unicode.ToUpper(first))
+}
+
+// groupKeyName returns the name of the group key's column in the reports, the column's name for column:<name>.
+func groupKeyName(key string) string {
+	return strings.TrimSpace(strings.TrimPrefix(key, GroupKeyColumn))
+}
+
+// splitGroupKey returns the values of the composite key.
+func splitGroupKey(key string) []string {
+	return strings.Split(key, groupKeySeparator)
+}
+
+// groupCounts orders the composite keys counted in the map and splits them into their values. It returns the
+// ordered groups along with the number of distinct groups.
+func groupCounts(groups map[string]int, config *Config) ([]DomainCount, int, error) {
+	counts, err := sortDomainCounts(groups, config.SortOrder, config.Top)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range counts {
+		counts[i].Key, counts[i].Domain = splitGroupKey(counts[i].Domain), ""
+	}
+
+	return counts, len(groups), nil
+}
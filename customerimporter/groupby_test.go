@@ -0,0 +1,163 @@
+package customerimporter
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateGroupBy(t *testing.T) {
+	testCases := []struct {
+		name        string
+		keys        []string
+		aggregation string
+		expectedErr string
+	}{
+		{name: "Default", keys: nil, aggregation: AggregationBoth},
+		{name: "Domain alone with both aggregations", keys: []string{GroupKeyDomain}, aggregation: AggregationBoth},
+		{name: "Composite key", keys: []string{GroupKeyDomain, GroupKeyGender, GroupKeyIPPrefix, GroupKeyLastInitial, "column:country"}, aggregation: AggregationRegistrable},
+		{name: "Unknown key", keys: []string{"age"}, expectedErr: `unknown group key "age"`},
+		{name: "Column without name", keys: []string{"column:"}, expectedErr: `unknown group key "column:"`},
+		{name: "Composite key with both aggregations", keys: []string{GroupKeyDomain, GroupKeyGender}, aggregation: AggregationBoth, expectedErr: "can't report both"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given, When
+			err := validateGroupBy(tc.keys, tc.aggregation)
+
+			// Then
+			if tc.expectedErr == "" && err != nil {
+				t.Errorf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if tc.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), tc.expectedErr)) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestIPPrefix(t *testing.T) {
+	testCases := []struct {
+		name          string
+		address       string
+		expectedValue string
+	}{
+		{name: "IPv4", address: "38.194.51.128", expectedValue: "38.194.51.0/24"},
+		{name: "IPv4 with spaces", address: " 10.0.0.1 ", expectedValue: "10.0.0.0/24"},
+		{name: "IPv4-mapped IPv6", address: "::ffff:10.0.0.1", expectedValue: "10.0.0.0/24"},
+		{name: "IPv6", address: "2001:db8:85a3::8a2e:370:7334", expectedValue: "2001:db8:85a3::/48"},
+		{name: "IPv6 with zone", address: "fe80::1%eth0", expectedValue: "fe80::/48"},
+		{name: "Invalid", address: "256.1.1.1", expectedValue: ""},
+		{name: "Empty", address: "", expectedValue: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given, When
+			prefix := ipPrefix(tc.address)
+
+			// Then
+			if prefix != tc.expectedValue {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, prefix)
+			}
+		})
+	}
+}
+
+func TestGrouperKey(t *testing.T) {
+	header := []string{"first_name", "last_name", "email", "gender", "ip_address", "Country"}
+	record := []string{"Mildred", "ørsted", "mhernandez0@mail.google.com", "Female", "38.194.51.128", " Poland "}
+	customer := &Customer{FirstName: "Mildred", LastName: "ørsted", Email: "mhernandez0@mail.google.com", Gender: "Female", IPAddress: "38.194.51.128"}
+
+	testCases := []struct {
+		name          string
+		config        *Config
+		expectedValue []string
+	}{
+		{
+			name:          "Domain and gender",
+			config:        &Config{GroupBy: []string{GroupKeyDomain, GroupKeyGender}},
+			expectedValue: []string{"mail.google.com", "Female"},
+		},
+		{
+			name:          "Registrable domain",
+			config:        &Config{GroupBy: []string{GroupKeyDomain, GroupKeyLastInitial}, Aggregation: AggregationRegistrable},
+			expectedValue: []string{"google.com", "Ø"},
+		},
+		{
+			name:          "IP prefix and named column",
+			config:        &Config{GroupBy: []string{GroupKeyIPPrefix, "column:country"}},
+			expectedValue: []string{"38.194.51.0/24", "Poland"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			grouper, err := newGrouper(tc.config, header)
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+
+			// When
+			key := grouper.key(record, customer, "mail.google.com")
+
+			// Then
+			if !reflect.DeepEqual(splitGroupKey(key), tc.expectedValue) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, splitGroupKey(key))
+			}
+		})
+	}
+}
+
+func TestNewGrouperColumnNotFound(t *testing.T) {
+	// Given
+	config := &Config{GroupBy: []string{GroupKeyDomain, "column:country"}}
+
+	// When
+	grouper, err := newGrouper(config, customerFields)
+
+	// Then
+	if err == nil || grouper != nil {
+		t.Errorf("Unexpected result. Expected an error, Got: %v, %v", grouper, err)
+	}
+}
+
+func TestRunGroupBy(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	config.InputCSVFilePathDefault = config.InputCSVFilePath10Lines
+	config.GroupBy = []string{GroupKeyDomain, GroupKeyGender}
+	config.Dedup = true
+
+	// When
+	result, err := Run(context.Background(), log, config)
+
+	// Then
+	if err != nil {
+		t.Fatalf("Error running import: %v", err)
+	}
+
+	expectedDomains := []DomainCount{
+		{Key: []string{"cnet.com", "Female"}, Count: 1, Unique: 1},
+		{Key: []string{"github.com", "Female"}, Count: 1, Unique: 1},
+		{Key: []string{"github.com", "Male"}, Count: 1, Unique: 1},
+		{Key: []string{"github.io", "Female"}, Count: 1, Unique: 1},
+		{Key: []string{"github.io", "Male"}, Count: 2, Unique: 2},
+		{Key: []string{"hubpages.com", "Male"}, Count: 1, Unique: 1},
+		{Key: []string{"rediff.com", "Male"}, Count: 1, Unique: 1},
+		{Key: []string{"statcounter.com", "Male"}, Count: 1, Unique: 1},
+	}
+	if !reflect.DeepEqual(result.Domains, expectedDomains) {
+		t.Errorf("Unexpected groups. Expected: %v, Got: %v", expectedDomains, result.Domains)
+	}
+	if result.DistinctDomains != len(expectedDomains) || !reflect.DeepEqual(result.GroupBy, config.GroupBy) {
+		t.Errorf("Unexpected groups summary. Expected: %v groups by %v, Got: %v groups by %v", len(expectedDomains), config.GroupBy, result.DistinctDomains, result.GroupBy)
+	}
+}
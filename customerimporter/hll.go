@@ -0,0 +1,187 @@
+package customerimporter
+
+import (
+	"fmt"
+	"hash/maphash"
+	"math"
+	"math/bits"
+)
+
+// Modes of counting the unique customers.
+const (
+	DedupModeExact = "exact" // Count the distinct emails exactly, spilling them to disk past DEDUP_MAX_IN_MEMORY.
+	DedupModeHLL   = "hll"   // Estimate the distinct emails with HyperLogLog sketches in a fixed amount of memory.
+)
+
+// DefaultDedupMode is the mode used when DEDUP_MODE isn't set.
+const DefaultDedupMode = DedupModeExact
+
+// DedupModes lists the supported modes of counting the unique customers.
+var DedupModes = []string{DedupModeExact, DedupModeHLL}
+
+// Precisions of the HyperLogLog sketches. A sketch of precision p has 2^p registers of a byte each and a relative
+// standard error of 1.04/sqrt(2^p), e.g. 16KB and 0.81% for the default precision of 14.
+const (
+	MinHLLPrecision     = 4
+	MaxHLLPrecision     = 18
+	DefaultHLLPrecision = 14
+)
+
+// validateDedupMode returns an error if the mode isn't supported. An empty mode stands for exact.
+func validateDedupMode(mode string) error {
+	switch mode {
+	case "", DedupModeExact, DedupModeHLL:
+		return nil
+	default:
+		return fmt.Errorf("unknown dedup mode %q, expected one of %q", mode, DedupModes)
+	}
+}
+
+// hllPrecision returns the HyperLogLog precision of the config, the default one if it isn't set.
+func hllPrecision(config *Config) uint8 {
+	if config.HLLPrecision == 0 {
+		return DefaultHLLPrecision
+	}
+	return uint8(config.HLLPrecision)
+}
+
+// hllStdError returns the relative standard error of the estimates of a HyperLogLog sketch of the given precision.
+// About 68% of the estimates are within one standard error of the exact count and 95% within two.
+func hllStdError(precision uint8) float64 {
+	return 1.04 / math.Sqrt(float64(uint64(1)<<precision))
+}
+
+// hllUniqueCounter estimates the unique customers with a HyperLogLog sketch per domain and one for all the domains.
+// A customer found in several domains (e.g. both gmail.com and googlemail.com) is estimated in each of them, but
+// once in the total: unlike exactUniqueCounter it doesn't keep the emails, so it can't tell which domain is the
+// smallest one the customer was found in.
+type hllUniqueCounter struct {
+	precision uint8
+	seed      maphash.Seed
+	domains   map[string]*hyperLogLog
+	total     *hyperLogLog
+}
+
+// newHLLUniqueCounter returns a hllUniqueCounter whose sketches have the given precision.
+func newHLLUniqueCounter(precision uint8) *hllUniqueCounter {
+	return &hllUniqueCounter{
+		precision: precision,
+		seed:      maphash.MakeSeed(),
+		domains:   make(map[string]*hyperLogLog),
+		total:     newHyperLogLog(precision),
+	}
+}
+
+// Add adds the hash of the email to the sketches of the domain and of all the domains.
+func (c *hllUniqueCounter) Add(domain, email string) error {
+	hash := maphash.String(c.seed, email)
+
+	sketch, ok := c.domains[domain]
+	if !ok {
+		sketch = newHyperLogLog(c.precision)
+		c.domains[domain] = sketch
+	}
+	sketch.Add(hash)
+	c.total.Add(hash)
+
+	return nil
+}
+
+// Counts returns the estimated unique customers per domain and of all the domains.
+func (c *hllUniqueCounter) Counts() (map[string]int, int, error) {
+	counts := make(map[string]int, len(c.domains))
+	for domain, sketch := range c.domains {
+		counts[domain] = sketch.Count()
+	}
+
+	return counts, c.total.Count(), nil
+}
+
+// Close does nothing, the sketches are in memory.
+func (c *hllUniqueCounter) Close() error {
+	return nil
+}
+
+// hyperLogLog is a HyperLogLog sketch estimating the number of distinct 64-bit hashes added to it. The top bits of
+// a hash select one of the 2^precision registers, which keeps the longest run of leading zeros of the other bits
+// (plus one) seen. Most domains hold few customers, so the registers are kept in a sparse map until it would take
+// about as much memory as the dense registers.
+type hyperLogLog struct {
+	precision uint8
+	sparse    map[uint32]uint8 // Non-zero registers, until the sketch is dense.
+	dense     []uint8
+}
+
+// newHyperLogLog returns an empty sparse sketch of the given precision.
+func newHyperLogLog(precision uint8) *hyperLogLog {
+	return &hyperLogLog{precision: precision, sparse: make(map[uint32]uint8)}
+}
+
+// Add adds the hash to the sketch.
+func (h *hyperLogLog) Add(hash uint64) {
+	index := uint32(hash >> (64 - h.precision))
+	rank := uint8(min(bits.LeadingZeros64(hash<<h.precision), 64-int(h.precision)) + 1)
+
+	if h.dense != nil {
+		h.dense[index] = max(h.dense[index], rank)
+		return
+	}
+
+	if rank <= h.sparse[index] {
+		return
+	}
+	h.sparse[index] = rank
+
+	// A map entry takes about 16 bytes, a dense register one.
+	if len(h.sparse) > (1<<h.precision)/16 {
+		h.dense = make([]uint8, 1<<h.precision)
+		for index, rank := range h.sparse {
+			h.dense[index] = rank
+		}
+		h.sparse = nil
+	}
+}
+
+// Count returns the estimated number of distinct hashes added to the sketch. Small cardinalities, while many
+// registers are still empty, are estimated by linear counting, which is more accurate there.
+func (h *hyperLogLog) Count() int {
+	m := float64(uint64(1) << h.precision)
+
+	var sum float64
+	var zeros int
+	if h.dense != nil {
+		for _, rank := range h.dense {
+			sum += math.Ldexp(1, -int(rank))
+			if rank == 0 {
+				zeros++
+			}
+		}
+	} else {
+		zeros = (1 << h.precision) - len(h.sparse)
+		sum = float64(zeros)
+		for _, rank := range h.sparse {
+			sum += math.Ldexp(1, -int(rank))
+		}
+	}
+
+	estimate := hllAlpha(h.precision) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return int(math.Round(estimate))
+}
+
+// hllAlpha returns the bias correction constant of the sketches of the given precision.
+func hllAlpha(precision uint8) float64 {
+	switch precision {
+	case 4:
+		return 0.673
+	case 5:
+		return 0.697
+	case 6:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(uint64(1)<<precision))
+	}
+}
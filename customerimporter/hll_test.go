@@ -0,0 +1,164 @@
+package customerimporter
+
+import (
+	"context"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	testCases := []struct {
+		name        string
+		precision   uint8
+		cardinality int
+	}{
+		{name: "Empty", precision: DefaultHLLPrecision, cardinality: 0},
+		{name: "Single hash", precision: DefaultHLLPrecision, cardinality: 1},
+		{name: "Sparse", precision: DefaultHLLPrecision, cardinality: 500},
+		{name: "Dense", precision: DefaultHLLPrecision, cardinality: 100_000},
+		{name: "Dense past linear counting", precision: MinHLLPrecision + 6, cardinality: 1_000_000},
+		{name: "Maximum precision", precision: MaxHLLPrecision, cardinality: 200_000},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			sketch := newHyperLogLog(tc.precision)
+			seed := maphash.MakeSeed()
+
+			// When
+			for repeat := 0; repeat < 2; repeat++ { // Adding the hashes again doesn't change the estimate.
+				for i := 0; i < tc.cardinality; i++ {
+					sketch.Add(maphash.String(seed, fmt.Sprintf("customer%d@example.com", i)))
+				}
+			}
+			count := sketch.Count()
+
+			// Then
+			tolerance := 4 * hllStdError(tc.precision) * float64(tc.cardinality)
+			if math.Abs(float64(count-tc.cardinality)) > tolerance {
+				t.Errorf("Test %s failed. Expected: %v ± %.0f, Got: %v", tc.name, tc.cardinality, tolerance, count)
+			}
+		})
+	}
+}
+
+func TestHyperLogLogSparseAndDenseAgree(t *testing.T) {
+	// Given
+	seed := maphash.MakeSeed()
+	sparse, dense := newHyperLogLog(DefaultHLLPrecision), newHyperLogLog(DefaultHLLPrecision)
+	dense.dense = make([]uint8, 1<<DefaultHLLPrecision)
+	dense.sparse = nil
+
+	// When
+	for i := 0; i < 300; i++ {
+		hash := maphash.String(seed, fmt.Sprintf("customer%d@example.com", i))
+		sparse.Add(hash)
+		dense.Add(hash)
+	}
+
+	// Then
+	if sparse.dense != nil {
+		t.Fatalf("Unexpected dense sketch. Expected the sketch of 300 hashes to stay sparse")
+	}
+	if sparse.Count() != dense.Count() {
+		t.Errorf("Unexpected estimate. Expected: %v, Got: %v", dense.Count(), sparse.Count())
+	}
+}
+
+func TestRunHLLDedup(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	config.InputCSVFilePathDefault = config.InputCSVFilePath3kLines
+	config.Dedup = true
+
+	exact, err := Run(context.Background(), log, config)
+	if err != nil {
+		t.Fatalf("Error running exact import: %v", err)
+	}
+
+	// When
+	config.DedupMode = DedupModeHLL
+	estimated, err := Run(context.Background(), log, config)
+
+	// Then
+	if err != nil {
+		t.Fatalf("Error running estimated import: %v", err)
+	}
+	if estimated.UniqueError != hllStdError(DefaultHLLPrecision) {
+		t.Errorf("Unexpected unique error. Expected: %v, Got: %v", hllStdError(DefaultHLLPrecision), estimated.UniqueError)
+	}
+	tolerance := 4 * estimated.UniqueError * float64(exact.UniqueCustomers)
+	if math.Abs(float64(estimated.UniqueCustomers-exact.UniqueCustomers)) > tolerance {
+		t.Errorf("Unexpected unique customers. Expected: %v ± %.0f, Got: %v", exact.UniqueCustomers, tolerance, estimated.UniqueCustomers)
+	}
+
+	// Linear counting is nearly exact for the few customers of a domain, off by one when two emails share a register.
+	for i, domain := range estimated.Domains {
+		if diff := domain.Unique - exact.Domains[i].Unique; diff < -1 || diff > 1 {
+			t.Errorf("Unexpected unique customers of %s. Expected: %v ± 1, Got: %v", domain.Domain, exact.Domains[i].Unique, domain.Unique)
+		}
+	}
+}
+
+func TestRunDedupModesCustomerInSeveralDomains(t *testing.T) {
+	testCases := []struct {
+		name            string
+		dedupMode       string
+		expectedDomains []DomainCount
+	}{
+		{
+			name:      "Exact counts the customer in the smallest domain",
+			dedupMode: DedupModeExact,
+			expectedDomains: []DomainCount{
+				{Domain: "gmail.com", Count: 1, Unique: 1},
+				{Domain: "googlemail.com", Count: 1, Unique: 0},
+			},
+		},
+		{
+			name:      "HLL counts the customer in each domain",
+			dedupMode: DedupModeHLL,
+			expectedDomains: []DomainCount{
+				{Domain: "gmail.com", Count: 1, Unique: 1},
+				{Domain: "googlemail.com", Count: 1, Unique: 1},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			log := NewMockLogger()
+			config, err := LoadConfigTest(log, "./.env")
+			if err != nil {
+				t.Fatalf("Error loading config: %v", err)
+			}
+			config.Dedup = true
+			config.DedupRules = DefaultDedupRules
+			config.DedupMode = tc.dedupMode
+			config.HLLPrecision = MaxHLLPrecision // Linear counting of a single customer is exact.
+
+			// When
+			result, err := RunReader(context.Background(), log, config, strings.NewReader("email\njohndoe@googlemail.com\njohn.doe@gmail.com\n"))
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Error running import: %v", tc.name, err)
+			}
+			if !reflect.DeepEqual(result.Domains, tc.expectedDomains) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedDomains, result.Domains)
+			}
+			if result.UniqueCustomers != 1 {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, 1, result.UniqueCustomers)
+			}
+		})
+	}
+}
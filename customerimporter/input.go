@@ -0,0 +1,140 @@
+package customerimporter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StdinPath is the input file path which makes Run read the CSV data from the standard input.
+const StdinPath = "-"
+
+// expandInputs expands the glob patterns among the given paths into the files matching them. Paths without glob
+// meta characters are kept as they are. The files written by the import, i.e. the rejects files and the output file
+// of the config, aren't matched, so a rerun doesn't import the files of the previous run. It fails when a pattern
+// matches no other files.
+func expandInputs(config *Config, paths []string) ([]string, error) {
+	var inputs []string
+	for _, path := range paths {
+		if path == StdinPath || !isGlob(path) {
+			inputs = append(inputs, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, err
+		}
+		count := len(inputs)
+		for _, match := range matches {
+			if !isOutputFile(config, match) {
+				inputs = append(inputs, match)
+			}
+		}
+		if len(inputs) == count {
+			return nil, fmt.Errorf("no CSV files match %q", path)
+		}
+	}
+
+	return inputs, nil
+}
+
+// isOutputFile reports whether the path is one of the files written by the import: a rejects file or the output file
+// of the config.
+func isOutputFile(config *Config, path string) bool {
+	if strings.HasSuffix(path, rejectsFileSuffix) {
+		return true
+	}
+	for _, output := range []string{config.OutputFilePath, config.RejectsCSVFilePath} {
+		if output != "" && samePath(output, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// samePath reports whether both paths stand for the same file, once made absolute.
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
+
+// isGlob reports whether the path is a glob pattern, i.e. it contains any of the glob meta characters.
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// openInput opens the CSV file at the given path. The "-" path stands for the standard input.
+func openInput(path string) (io.ReadCloser, error) {
+	if path == StdinPath {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	return os.Open(path)
+}
+
+// importFile opens the CSV file at the given path and imports it, writing the rejected rows alongside it if configured.
+func importFile(ctx context.Context, log Logger, config *Config, path string, unique uniqueCounter) (map[string]int, Stats, error) {
+	file, err := openInput(path)
+	if err != nil {
+		log.Warn("Error opening CSV file.", err)
+		return nil, Stats{}, err
+	}
+	defer file.Close()
+
+	return importReader(ctx, log, config, file, rejectsFilePath(config, path), unique)
+}
+
+// importReader prepares a CSV file reader of r and processes the email domains, writing the rejected rows to the
+// rejects file at the given path, if any, and adding the customers to the unique counter, if any. In the mmap reader
+// mode, a file which can't be memory-mapped is read through a buffered reader.
+func importReader(ctx context.Context, log Logger, config *Config, r io.Reader, rejectsPath string, unique uniqueCounter) (map[string]int, Stats, error) {
+	if file, ok := r.(*os.File); ok && config.ReaderMode == ReaderModeMmap {
+		mapped, err := mmapFile(file)
+		if err != nil {
+			log.Info("Memory-mapping the file isn't possible, it is read through a buffered reader.", "error", err)
+		} else {
+			defer mapped.Close() // Once the workers are done with the mapped bytes.
+			r = mapped
+		}
+	}
+
+	reader, err := createCSVfileReader(log, config, r)
+	if err != nil {
+		return nil, Stats{}, err
+	}
+	defer reader.Close()
+
+	_, mapped := r.(*mappedFile)
+	if file, ok := r.(seekableFile); ok && (config.ReaderMode == ReaderModeChunked || mapped) {
+		if err := splitIntoChunks(log, config, reader, file); err != nil {
+			log.Warn("Splitting the file into chunks failed.", err)
+			return nil, Stats{}, err
+		}
+	}
+
+	var rejects *rejectsWriter
+	if rejectsPath != "" {
+		rejectsFile, err := os.Create(rejectsPath)
+		if err != nil {
+			log.Warn("Error creating rejects file.", err)
+			return nil, Stats{}, err
+		}
+		defer rejectsFile.Close()
+
+		rejects, err = newRejectsWriter(rejectsFile, reader.header, reader.Comma)
+		if err != nil {
+			log.Warn("Error writing rejects file.", err)
+			return nil, Stats{}, err
+		}
+	}
+
+	return processEmailDomainsConcurrently(ctx, log, config, reader, rejects, unique)
+}
@@ -0,0 +1,324 @@
+package customerimporter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunReader(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	input := "first_name,last_name,email,gender,ip_address\n" +
+		"Mildred,Hernandez,mhernandez0@github.io,Female,38.194.51.128\n" +
+		"Bonnie,Ortiz,bortiz1@cyberchimps.com,Female,197.54.209.129\n" +
+		"Dennis,Henry,dhenry2@github.io,Male,155.75.186.217\n"
+
+	// When
+	result, err := RunReader(context.Background(), log, config, strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Error running import: %v", err)
+	}
+
+	// Then
+	expectedDomains := []DomainCount{
+		{Domain: "cyberchimps.com", Count: 1},
+		{Domain: "github.io", Count: 2},
+	}
+	if !reflect.DeepEqual(result.Domains, expectedDomains) {
+		t.Errorf("Unexpected domains. Expected: %v, Got: %v", expectedDomains, result.Domains)
+	}
+	if result.RowsRead != 3 {
+		t.Errorf("Unexpected rows read. Expected: %v, Got: %v", 3, result.RowsRead)
+	}
+	if result.Files != nil {
+		t.Errorf("Unexpected files. Expected: %v, Got: %v", nil, result.Files)
+	}
+}
+
+func TestRunFiles(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	// When
+	result, err := RunFiles(context.Background(), log, config, config.InputCSVFilePath10Lines, config.InputCSVFilePath10Lines)
+	if err != nil {
+		t.Fatalf("Error running import: %v", err)
+	}
+
+	// Then
+	expectedDomains := []DomainCount{
+		{Domain: "cnet.com", Count: 2},
+		{Domain: "github.com", Count: 4},
+		{Domain: "github.io", Count: 6},
+		{Domain: "hubpages.com", Count: 2},
+		{Domain: "rediff.com", Count: 2},
+		{Domain: "statcounter.com", Count: 2},
+	}
+	if !reflect.DeepEqual(result.Domains, expectedDomains) {
+		t.Errorf("Unexpected domains. Expected: %v, Got: %v", expectedDomains, result.Domains)
+	}
+
+	expectedStats := Stats{RowsRead: 18, RowsRejected: 0}
+	if !reflect.DeepEqual(result.Stats, expectedStats) {
+		t.Errorf("Unexpected stats. Expected: %v, Got: %v", expectedStats, result.Stats)
+	}
+
+	if len(result.Files) != 2 {
+		t.Fatalf("Unexpected number of files. Expected: %v, Got: %v", 2, len(result.Files))
+	}
+	for _, file := range result.Files {
+		if file.Path != config.InputCSVFilePath10Lines || file.RowsRead != 9 || file.DistinctDomains != 6 {
+			t.Errorf("Unexpected file subtotals. Expected: %v with 9 rows and 6 domains, Got: %+v", config.InputCSVFilePath10Lines, file)
+		}
+	}
+}
+
+func TestRunStaleDefaultInput(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	config.InputCSVFilePathDefault = "/nonexistent/customers.csv" // Never read by RunFiles nor RunReader.
+
+	input, err := os.ReadFile(config.InputCSVFilePath10Lines)
+	if err != nil {
+		t.Fatalf("Error reading the input: %v", err)
+	}
+
+	// When
+	filesResult, filesErr := RunFiles(context.Background(), log, config, config.InputCSVFilePath10Lines)
+	readerResult, readerErr := RunReader(context.Background(), log, config, strings.NewReader(string(input)))
+
+	// Then
+	if filesErr != nil || readerErr != nil {
+		t.Fatalf("Unexpected errors. Expected: %v, Got: %v, %v", nil, filesErr, readerErr)
+	}
+	if !reflect.DeepEqual(filesResult.Domains, readerResult.Domains) || filesResult.RowsRead != 9 {
+		t.Errorf("Unexpected results. Expected: 9 rows read, Got: %v, %v", filesResult, readerResult)
+	}
+}
+
+func TestRunFilesGlob(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"customers_1.csv": "email\na@github.com\nb@github.io\n",
+		"customers_2.csv": "email\nc@github.com\n",
+		"other.csv":       "email\nd@cnet.com\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Error writing CSV file: %v", err)
+		}
+	}
+
+	// When
+	result, err := RunFiles(context.Background(), log, config, filepath.Join(dir, "customers_*.csv"))
+	if err != nil {
+		t.Fatalf("Error running import: %v", err)
+	}
+
+	// Then
+	expectedDomains := []DomainCount{
+		{Domain: "github.com", Count: 2},
+		{Domain: "github.io", Count: 1},
+	}
+	if !reflect.DeepEqual(result.Domains, expectedDomains) {
+		t.Errorf("Unexpected domains. Expected: %v, Got: %v", expectedDomains, result.Domains)
+	}
+
+	expectedPaths := []string{filepath.Join(dir, "customers_1.csv"), filepath.Join(dir, "customers_2.csv")}
+	var paths []string
+	for _, file := range result.Files {
+		paths = append(paths, file.Path)
+	}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("Unexpected files. Expected: %v, Got: %v", expectedPaths, paths)
+	}
+}
+
+func TestRunFilesErrors(t *testing.T) {
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	testCases := []struct {
+		name          string
+		config        Config
+		paths         []string
+		expectedValue string
+	}{
+		{
+			name:          "No matching files",
+			config:        *config,
+			paths:         []string{filepath.Join(t.TempDir(), "*.csv")},
+			expectedValue: "no CSV files match",
+		},
+		{
+			name:          "Missing file",
+			config:        *config,
+			paths:         []string{filepath.Join(t.TempDir(), "missing.csv")},
+			expectedValue: "no such file or directory",
+		},
+		{
+			name:          "Path relative to the module's root directory",
+			config:        *config,
+			paths:         []string{"data/test/customers_10_lines.csv"}, // Opened as given, not resolved like the .env file.
+			expectedValue: "no such file or directory",
+		},
+		{
+			name:          "Pattern relative to the module's root directory",
+			config:        *config,
+			paths:         []string{"data/test/customers_*.csv"},
+			expectedValue: "no CSV files match",
+		},
+		{
+			name: "Rejects file path with several files",
+			config: func() Config {
+				c := *config
+				c.RejectsCSVFilePath = filepath.Join(t.TempDir(), "rejects.csv")
+				return c
+			}(),
+			paths:         []string{config.InputCSVFilePath10Lines, config.InputCSVFilePath10Lines},
+			expectedValue: "REJECTS_CSV_FILE_PATH can't be used with 2 input files",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given, When
+			result, err := RunFiles(context.Background(), log, &tc.config, tc.paths...)
+
+			// Then
+			if err == nil || !strings.Contains(err.Error(), tc.expectedValue) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, err)
+			}
+			if result != nil {
+				t.Errorf("Test %s failed. Expected no result, Got: %v", tc.name, result)
+			}
+		})
+	}
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.csv", "a.csv", "a.rejects.csv", "b.rejects.csv", "report.csv"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatalf("Error writing CSV file: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		name           string
+		config         *Config
+		paths          []string
+		expectedInputs []string
+		expectedErr    bool
+	}{
+		{
+			name:           "Paths and a pattern",
+			config:         &Config{},
+			paths:          []string{StdinPath, "customers.csv", filepath.Join(dir, "[ab].csv")},
+			expectedInputs: []string{StdinPath, "customers.csv", filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv")},
+		},
+		{
+			name:           "Pattern matching the rejects files and the output file",
+			config:         &Config{OutputFilePath: filepath.Join(dir, "report.csv")},
+			paths:          []string{filepath.Join(dir, "*.csv")},
+			expectedInputs: []string{filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv")},
+		},
+		{
+			name:        "Pattern matching the rejects file of the config",
+			config:      &Config{RejectsCSVFilePath: filepath.Join(dir, "report.csv")},
+			paths:       []string{filepath.Join(dir, "report*")},
+			expectedErr: true,
+		},
+		{
+			name:           "Rejects file given as a path",
+			config:         &Config{},
+			paths:          []string{filepath.Join(dir, "a.rejects.csv")},
+			expectedInputs: []string{filepath.Join(dir, "a.rejects.csv")},
+		},
+		{
+			name:        "Pattern matching only the rejects files",
+			config:      &Config{},
+			paths:       []string{filepath.Join(dir, "*.rejects.csv")},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// When
+			inputs, err := expandInputs(tc.config, tc.paths)
+
+			// Then
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("Test %s failed. Expected error: %v, Got: %v", tc.name, tc.expectedErr, err)
+			}
+			if !reflect.DeepEqual(inputs, tc.expectedInputs) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedInputs, inputs)
+			}
+		})
+	}
+}
+
+func TestRunFilesGlobRerunWithRejects(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	config.WriteRejects = true
+
+	dir := t.TempDir()
+	config.OutputFilePath = filepath.Join(dir, "report.csv")
+	if err := os.WriteFile(filepath.Join(dir, "customers.csv"), []byte("email\na@github.com\nnot an email\n"), 0o644); err != nil {
+		t.Fatalf("Error writing CSV file: %v", err)
+	}
+	pattern := filepath.Join(dir, "*.csv")
+	first, err := RunFiles(context.Background(), log, config, pattern)
+	if err != nil {
+		t.Fatalf("Error running first import: %v", err)
+	}
+	if err := WriteResult(config, first); err != nil {
+		t.Fatalf("Error writing the report: %v", err)
+	}
+
+	// When
+	second, err := RunFiles(context.Background(), log, config, pattern)
+
+	// Then
+	if err != nil {
+		t.Fatalf("Error running second import: %v", err)
+	}
+	if !reflect.DeepEqual(second.Domains, first.Domains) || second.Stats.RowsRejected != first.Stats.RowsRejected {
+		t.Errorf("Unexpected second import. Expected: %v, %v, Got: %v, %v", first.Domains, first.Stats, second.Domains, second.Stats)
+	}
+	if len(second.Files) != 1 {
+		t.Errorf("Unexpected files. Expected: %v, Got: %v", 1, len(second.Files))
+	}
+}
@@ -0,0 +1,53 @@
+package customerimporter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// errMmapUnsupported is returned by mmapFile where memory-mapping files isn't supported.
+var errMmapUnsupported = errors.New("memory-mapped files aren't supported on this platform")
+
+// mappedFile is a memory-mapped file, read like the file itself. Its bytes are valid until it is closed.
+type mappedFile struct {
+	*bytes.Reader
+	data  []byte
+	info  os.FileInfo
+	unmap func() error
+}
+
+// newMappedFile returns the mappedFile of the mapped bytes of the file, released by unmap.
+func newMappedFile(data []byte, info os.FileInfo, unmap func() error) *mappedFile {
+	return &mappedFile{Reader: bytes.NewReader(data), data: data, info: info, unmap: unmap}
+}
+
+// Stat returns the FileInfo of the mapped file.
+func (m *mappedFile) Stat() (os.FileInfo, error) {
+	return m.info, nil
+}
+
+// Close unmaps the file, its bytes must not be used anymore.
+func (m *mappedFile) Close() error {
+	return m.unmap()
+}
+
+// mappedReader reads the lines of mapped bytes, slicing them out of the mapping instead of copying them.
+type mappedReader struct {
+	data   []byte
+	offset int
+}
+
+// ReadSlice returns the bytes up to and including the delimiter, like bufio.Reader.ReadSlice, or the rest of the
+// bytes along with io.EOF if there is no delimiter left. It never returns bufio.ErrBufferFull.
+func (m *mappedReader) ReadSlice(delim byte) ([]byte, error) {
+	rest := m.data[m.offset:]
+	if i := bytes.IndexByte(rest, delim); i >= 0 {
+		m.offset += i + 1
+		return rest[:i+1], nil
+	}
+
+	m.offset = len(m.data)
+	return rest, io.EOF
+}
@@ -0,0 +1,34 @@
+//go:build linux
+
+package customerimporter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the regular file read-only into memory.
+func mmapFile(file *os.File) (*mappedFile, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	switch size := info.Size(); {
+	case !info.Mode().IsRegular():
+		return nil, fmt.Errorf("%s isn't a regular file", file.Name())
+	case size == 0:
+		return nil, errors.New("an empty file can't be mapped")
+	case int64(int(size)) != size:
+		return nil, fmt.Errorf("%s is too large to be mapped", file.Name())
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMappedFile(data, info, func() error { return syscall.Munmap(data) }), nil
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+package customerimporter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMmapFile(t *testing.T) {
+	dir := t.TempDir()
+	content := "first_name,last_name,email,gender,ip_address\nMildred,Hernandez,mhernandez0@github.io,Female,38.194.51.128\n"
+	if err := os.WriteFile(filepath.Join(dir, "customers.csv"), []byte(content), 0o644); err != nil {
+		t.Fatalf("Error writing CSV file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "empty.csv"), nil, 0o644); err != nil {
+		t.Fatalf("Error writing CSV file: %v", err)
+	}
+
+	testCases := []struct {
+		name          string
+		path          string
+		expectedValue string
+		expectedError bool
+	}{
+		{
+			name:          "Regular file",
+			path:          filepath.Join(dir, "customers.csv"),
+			expectedValue: content,
+		},
+		{
+			name:          "Empty file",
+			path:          filepath.Join(dir, "empty.csv"),
+			expectedError: true,
+		},
+		{
+			name:          "Directory",
+			path:          dir,
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			file, err := os.Open(tc.path)
+			if err != nil {
+				t.Fatalf("Error opening file: %v", err)
+			}
+			defer file.Close()
+
+			// When
+			mapped, err := mmapFile(file)
+
+			// Then
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("Test %s failed. Expected error: %v, Got: %v", tc.name, tc.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			if string(mapped.data) != tc.expectedValue {
+				t.Errorf("Test %s failed. Expected: %q, Got: %q", tc.name, tc.expectedValue, string(mapped.data))
+			}
+			if err := mapped.Close(); err != nil {
+				t.Errorf("Test %s failed. Unexpected error unmapping the file: %v", tc.name, err)
+			}
+		})
+	}
+}
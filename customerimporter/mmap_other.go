@@ -0,0 +1,10 @@
+//go:build !linux
+
+package customerimporter
+
+import "os"
+
+// mmapFile returns errMmapUnsupported, the file is read through a buffered reader instead.
+func mmapFile(file *os.File) (*mappedFile, error) {
+	return nil, errMmapUnsupported
+}
@@ -0,0 +1,164 @@
+package customerimporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMappedReader(t *testing.T) {
+	testCases := []struct {
+		name          string
+		data          string
+		expectedLines []string
+	}{
+		{
+			name:          "Lines with line breaks",
+			data:          "a,b\nc,d\n",
+			expectedLines: []string{"a,b\n", "c,d\n"},
+		},
+		{
+			name:          "Last line without a line break",
+			data:          "a,b\nc,d",
+			expectedLines: []string{"a,b\n", "c,d"},
+		},
+		{
+			name: "No data",
+			data: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			reader := &mappedReader{data: []byte(tc.data)}
+
+			// When
+			var lines []string
+			for {
+				line, err := reader.ReadSlice('\n')
+				if len(line) > 0 {
+					lines = append(lines, string(line))
+				}
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+				}
+			}
+
+			// Then
+			if !reflect.DeepEqual(lines, tc.expectedLines) {
+				t.Errorf("Test %s failed. Expected: %q, Got: %q", tc.name, tc.expectedLines, lines)
+			}
+		})
+	}
+}
+
+func TestRunMmap(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	config.Concurrency = 4
+	config.WriteRejects = true
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "customers.csv")
+	writeChunkedTestFile(t, path)
+
+	run := func(t *testing.T, config *Config) (*Result, []string) {
+		t.Helper()
+
+		result, err := Run(context.Background(), log, withInput(config, path))
+		if err != nil {
+			t.Fatalf("Error running the import: %v", err)
+		}
+
+		rejected, err := os.ReadFile(filepath.Join(dir, "customers.rejects.csv"))
+		if err != nil {
+			t.Fatalf("Error reading the rejects file: %v", err)
+		}
+		rejects := strings.Split(string(rejected), "\n")
+		sort.Strings(rejects) // The rejects of the chunks are written in any order.
+		return result, rejects
+	}
+	expectedResult, expectedRejects := run(t, config)
+
+	for _, tc := range []struct {
+		name     string
+		fastPath bool
+	}{
+		{name: "Records"},
+		{name: "Fast path", fastPath: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := *config
+			config.ReaderMode = ReaderModeMmap
+			config.FastPath = tc.fastPath
+
+			// When
+			result, rejects := run(t, &config)
+
+			// Then
+			if !reflect.DeepEqual(result.Domains, expectedResult.Domains) || !reflect.DeepEqual(result.Stats, expectedResult.Stats) {
+				t.Errorf("Test %s failed. Expected: %+v, Got: %+v", tc.name, expectedResult.Stats, result.Stats)
+			}
+			if !reflect.DeepEqual(rejects, expectedRejects) {
+				t.Errorf("Test %s failed. Expected: %d rejects lines, Got: %d", tc.name, len(expectedRejects), len(rejects))
+			}
+		})
+	}
+}
+
+func TestFastScannerMapped(t *testing.T) {
+	// Given
+	data := []byte("Mildred,Hernandez,mhernandez0@github.io,Female,38.194.51.128\r\n\"Bonnie\",Ortiz,bortiz1@cyberchimps.com,Female,197.54.209.129\nDennis,Henry,dhenry2@hubpages.com,Male,155.75.186.217")
+	csvReader := csv.NewReader(bytes.NewReader(data))
+	reader := &csvFileReader{Reader: csvReader, columns: defaultColumnMapping()}
+	scanner := newFastScanner(recordSource{Reader: csvReader, mapped: data}, reader)
+	task := newTask(DefaultBatchSize, true)
+
+	// When
+	var records [][]string
+	for {
+		record, _, err := scanner.scan(&task)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if record != nil {
+			records = append(records, record)
+		}
+	}
+
+	// Then
+	if !task.fast.mapped || &task.fast.raw[0] != &data[0] {
+		t.Errorf("Unexpected fast batch. Expected the rows sliced out of the mapped bytes, Got: %q", task.fast.raw)
+	}
+	var emails []string
+	for _, row := range task.fast.rows {
+		emails = append(emails, string(task.fast.raw[row.emailStart:row.emailEnd]))
+	}
+	expectedEmails := []string{"mhernandez0@github.io", "dhenry2@hubpages.com"}
+	if !reflect.DeepEqual(emails, expectedEmails) || len(records) != 1 {
+		t.Errorf("Unexpected rows. Expected: %q and a quoted record, Got: %q and %q", expectedEmails, emails, records)
+	}
+
+	putFastBatch(task.fast)
+	if task.fast.raw != nil {
+		t.Errorf("Unexpected recycled fast batch. Expected the mapped bytes let go, Got: %q", task.fast.raw)
+	}
+}
@@ -0,0 +1,340 @@
+package customerimporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Output formats of the domain report.
+const (
+	FormatJSON   = "json"
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatTable  = "table"
+)
+
+// DefaultOutputFormat is the output format used when OUTPUT_FORMAT isn't set.
+const DefaultOutputFormat = FormatTable
+
+// OutputFormats lists the supported output formats.
+var OutputFormats = []string{FormatJSON, FormatCSV, FormatNDJSON, FormatTable}
+
+// ResultWriter writes the domain report of a Result in a given format.
+type ResultWriter interface {
+	Write(w io.Writer, result *Result) error
+}
+
+// NewResultWriter returns the ResultWriter of the given output format. An empty format stands for DefaultOutputFormat.
+func NewResultWriter(format string) (ResultWriter, error) {
+	if format == "" {
+		format = DefaultOutputFormat
+	}
+
+	switch format {
+	case FormatJSON:
+		return jsonResultWriter{}, nil
+	case FormatCSV:
+		return csvResultWriter{}, nil
+	case FormatNDJSON:
+		return ndjsonResultWriter{}, nil
+	case FormatTable:
+		return tableResultWriter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q, expected one of %q", format, OutputFormats)
+	}
+}
+
+// OpenOutput opens the file the domain report is written to. An empty path or "-" stands for the standard output,
+// which isn't closed by the returned closer.
+func OpenOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+
+	return os.Create(path)
+}
+
+// WriteResult writes the domain report of the result to the output file (or the standard output) in the output format of the config.
+func WriteResult(config *Config, result *Result) error {
+	writer, err := NewResultWriter(config.OutputFormat)
+	if err != nil {
+		return err
+	}
+
+	output, err := OpenOutput(config.OutputFilePath)
+	if err != nil {
+		return err
+	}
+
+	if err := writer.Write(output, result); err != nil {
+		output.Close()
+		return err
+	}
+
+	return output.Close()
+}
+
+// summary is the JSON representation of the import totals.
+type summary struct {
+	GroupBy         []string       `json:"group_by,omitempty"`
+	DistinctDomains int            `json:"distinct_domains"`
+	RowsRead        int            `json:"rows_read"`
+	RowsRejected    int            `json:"rows_rejected"`
+	RowsFiltered    int            `json:"rows_filtered,omitempty"`
+	ErrorsByReason  map[string]int `json:"errors_by_reason,omitempty"`
+	UniqueCustomers int            `json:"unique_customers,omitempty"`
+	UniqueError     float64        `json:"unique_error,omitempty"`
+	Duration        string         `json:"duration"`
+}
+
+// newSummary returns the import totals of the result.
+func newSummary(result *Result) summary {
+	return summary{
+		GroupBy:         result.GroupBy,
+		DistinctDomains: result.DistinctDomains,
+		RowsRead:        result.RowsRead,
+		RowsRejected:    result.RowsRejected,
+		RowsFiltered:    result.RowsFiltered,
+		ErrorsByReason:  result.ErrorsByReason,
+		UniqueCustomers: result.UniqueCustomers,
+		UniqueError:     result.UniqueError,
+		Duration:        result.Duration.String(),
+	}
+}
+
+// fileSummary is the JSON representation of the subtotals of one of the input files.
+type fileSummary struct {
+	Path string `json:"path"`
+	summary
+}
+
+// newFileSummaries returns the subtotals of the input files, or nil if the result holds a single file.
+func newFileSummaries(result *Result) []fileSummary {
+	if len(result.Files) < 2 {
+		return nil
+	}
+
+	files := make([]fileSummary, 0, len(result.Files))
+	for _, file := range result.Files {
+		files = append(files, fileSummary{Path: file.Path, summary: newSummary(&file.Result)})
+	}
+
+	return files
+}
+
+// jsonResultWriter writes a JSON document with the array of domains and the summary, plus the subtotals of each file
+// when several files were imported.
+type jsonResultWriter struct{}
+
+// Write writes the result as a JSON document.
+func (jsonResultWriter) Write(w io.Writer, result *Result) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(struct {
+		Domains []DomainCount `json:"domains"`
+		Summary summary       `json:"summary"`
+		Files   []fileSummary `json:"files,omitempty"`
+	}{domainsOrEmpty(result.Domains), newSummary(result), newFileSummaries(result)})
+}
+
+// ndjsonResultWriter writes one JSON object per domain and line.
+type ndjsonResultWriter struct{}
+
+// Write writes the result's domains as newline-delimited JSON.
+func (ndjsonResultWriter) Write(w io.Writer, result *Result) error {
+	encoder := json.NewEncoder(w)
+	for _, domain := range result.Domains {
+		if err := encoder.Encode(domain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// csvResultWriter writes a domain,count CSV file, with a unique column when deduplicating customers. With the exact
+// domains of the registrable domains it writes a registrable_domain,domain,count CSV file with a record per exact
+// domain instead. Grouped customers get a column per group key, e.g. domain,gender,count.
+type csvResultWriter struct{}
+
+// Write writes the result's domains as CSV records with a header line.
+func (csvResultWriter) Write(w io.Writer, result *Result) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"domain", "count"}
+	subdomains := hasSubdomains(result.Domains)
+	if subdomains {
+		header = []string{"registrable_domain", "domain", "count"}
+	}
+	if len(result.GroupBy) > 0 {
+		header = header[:0]
+		for _, key := range result.GroupBy {
+			header = append(header, groupKeyName(key))
+		}
+		header = append(header, "count")
+	}
+	if result.Deduplicated {
+		header = append(header, "unique")
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	record := func(domain DomainCount, prefix ...string) []string {
+		record := append(prefix, domain.Domain)
+		if domain.Key != nil {
+			record = append(prefix, domain.Key...)
+		}
+		record = append(record, strconv.Itoa(domain.Count))
+		if result.Deduplicated {
+			record = append(record, strconv.Itoa(domain.Unique))
+		}
+		return record
+	}
+
+	for _, domain := range result.Domains {
+		if !subdomains {
+			if err := writer.Write(record(domain)); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, subdomain := range domain.Subdomains {
+			if err := writer.Write(record(subdomain, domain.Domain)); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// tableResultWriter writes a human-readable table of domains followed by the summary. The unique customers are
+// written in an extra column when deduplicating customers, and grouped customers get a column per group key.
+type tableResultWriter struct{}
+
+// Write writes the result's domains as a table with aligned columns and the import totals below. The exact domains
+// of the registrable domains are indented below them.
+func (tableResultWriter) Write(w io.Writer, result *Result) error {
+	const indent = "  "
+
+	headers := []string{"DOMAIN"}
+	labels := func(domain DomainCount) []string { return []string{domain.Domain} }
+	if len(result.GroupBy) > 0 {
+		headers = make([]string, len(result.GroupBy))
+		for i, key := range result.GroupBy {
+			headers[i] = strings.ToUpper(groupKeyName(key))
+		}
+		labels = func(domain DomainCount) []string { return domain.Key }
+	}
+
+	labelWidths := make([]int, len(headers))
+	for i, header := range headers {
+		labelWidths[i] = len(header)
+	}
+	countWidth, uniqueWidth := len("COUNT"), len("UNIQUE")
+	for _, domain := range result.Domains {
+		for i, label := range labels(domain) {
+			labelWidths[i] = max(labelWidths[i], len(label))
+		}
+		countWidth = max(countWidth, len(strconv.Itoa(domain.Count)))
+		uniqueWidth = max(uniqueWidth, len(strconv.Itoa(domain.Unique)))
+		for _, subdomain := range domain.Subdomains {
+			labelWidths[0] = max(labelWidths[0], len(indent)+len(subdomain.Domain))
+		}
+	}
+
+	var b strings.Builder
+	row := func(labels []string, count, unique any) {
+		for i, label := range labels {
+			fmt.Fprintf(&b, "%-*s  ", labelWidths[i], label)
+		}
+		fmt.Fprintf(&b, "%*v", countWidth, count)
+		if result.Deduplicated {
+			fmt.Fprintf(&b, "  %*v", uniqueWidth, unique)
+		}
+		b.WriteByte('\n')
+	}
+
+	row(headers, "COUNT", "UNIQUE")
+	for _, domain := range result.Domains {
+		row(labels(domain), domain.Count, domain.Unique)
+		for _, subdomain := range domain.Subdomains {
+			row([]string{indent + subdomain.Domain}, subdomain.Count, subdomain.Unique)
+		}
+	}
+
+	if len(result.GroupBy) > 0 {
+		fmt.Fprintf(&b, "\nGroups:         %d\n", result.DistinctDomains)
+	} else {
+		fmt.Fprintf(&b, "\nDomains:        %d\n", result.DistinctDomains)
+	}
+	fmt.Fprintf(&b, "Rows read:      %d\n", result.RowsRead)
+	fmt.Fprintf(&b, "Rows rejected:  %d\n", result.RowsRejected)
+
+	reasons := make([]string, 0, len(result.ErrorsByReason))
+	for reason := range result.ErrorsByReason {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(&b, "  %s: %d\n", reason, result.ErrorsByReason[reason])
+	}
+
+	if result.RowsFiltered > 0 {
+		fmt.Fprintf(&b, "Rows filtered:  %d\n", result.RowsFiltered)
+	}
+
+	if result.Deduplicated && result.UniqueError > 0 {
+		fmt.Fprintf(&b, "Unique:         ~%d (±%.2f%% standard error)\n", result.UniqueCustomers, 100*result.UniqueError)
+	} else if result.Deduplicated {
+		fmt.Fprintf(&b, "Unique:         %d\n", result.UniqueCustomers)
+	}
+	fmt.Fprintf(&b, "Duration:       %s\n", result.Duration)
+
+	if len(result.Files) > 1 {
+		b.WriteString("\nFiles:\n")
+		for _, file := range result.Files {
+			fmt.Fprintf(&b, "  %s: %d rows read, %d rejected, %d domains\n", file.Path, file.RowsRead, file.RowsRejected, file.DistinctDomains)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// hasSubdomains reports whether the domains hold their exact domains, i.e. both aggregations are reported.
+func hasSubdomains(domains []DomainCount) bool {
+	for _, domain := range domains {
+		if len(domain.Subdomains) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// domainsOrEmpty returns an empty slice instead of nil so that no domains are encoded as [] rather than null.
+func domainsOrEmpty(domains []DomainCount) []DomainCount {
+	if domains == nil {
+		return []DomainCount{}
+	}
+	return domains
+}
+
+// nopWriteCloser is a writer with a Close method which does nothing, used for the standard output.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (nopWriteCloser) Close() error {
+	return nil
+}
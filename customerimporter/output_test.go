@@ -0,0 +1,440 @@
+package customerimporter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultWriters(t *testing.T) {
+	result := &Result{
+		Domains: []DomainCount{
+			{Domain: "github.com", Count: 2},
+			{Domain: "statcounter.com", Count: 12},
+		},
+		DistinctDomains: 5,
+		Stats: Stats{
+			RowsRead:       16,
+			RowsRejected:   2,
+			ErrorsByReason: map[string]int{ReasonInvalidEmail: 1, ReasonShortRow: 1},
+		},
+		Duration: 1500 * time.Microsecond,
+	}
+
+	testCases := []struct {
+		name          string
+		format        string
+		expectedValue string
+	}{
+		{
+			name:   "JSON",
+			format: FormatJSON,
+			expectedValue: `{
+  "domains": [
+    {
+      "domain": "github.com",
+      "count": 2
+    },
+    {
+      "domain": "statcounter.com",
+      "count": 12
+    }
+  ],
+  "summary": {
+    "distinct_domains": 5,
+    "rows_read": 16,
+    "rows_rejected": 2,
+    "errors_by_reason": {
+      "invalid email format": 1,
+      "short row": 1
+    },
+    "duration": "1.5ms"
+  }
+}
+`,
+		},
+		{
+			name:   "CSV",
+			format: FormatCSV,
+			expectedValue: `domain,count
+github.com,2
+statcounter.com,12
+`,
+		},
+		{
+			name:   "NDJSON",
+			format: FormatNDJSON,
+			expectedValue: `{"domain":"github.com","count":2}
+{"domain":"statcounter.com","count":12}
+`,
+		},
+		{
+			name:   "Table",
+			format: FormatTable,
+			expectedValue: `DOMAIN           COUNT
+github.com           2
+statcounter.com     12
+
+Domains:        5
+Rows read:      16
+Rows rejected:  2
+  invalid email format: 1
+  short row: 1
+Duration:       1.5ms
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			writer, err := NewResultWriter(tc.format)
+			if err != nil {
+				t.Fatalf("Error creating result writer: %v", err)
+			}
+			var buf bytes.Buffer
+
+			// When
+			err = writer.Write(&buf, result)
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if buf.String() != tc.expectedValue {
+				t.Errorf("Test %s failed. Expected: %q, Got: %q", tc.name, tc.expectedValue, buf.String())
+			}
+		})
+	}
+}
+
+func TestJSONResultWriterNoDomains(t *testing.T) {
+	// Given
+	var buf bytes.Buffer
+
+	// When
+	err := jsonResultWriter{}.Write(&buf, &Result{})
+
+	// Then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"domains": []`)) {
+		t.Errorf("Unexpected JSON. Expected an empty domains array, Got: %s", buf.String())
+	}
+}
+
+func TestResultWritersFiles(t *testing.T) {
+	result := &Result{
+		Domains:         []DomainCount{{Domain: "github.io", Count: 3}},
+		DistinctDomains: 1,
+		Stats:           Stats{RowsRead: 3},
+		Files: []FileResult{
+			{Path: "a.csv", Result: Result{DistinctDomains: 1, Stats: Stats{RowsRead: 2}}},
+			{Path: "b.csv", Result: Result{DistinctDomains: 1, Stats: Stats{RowsRead: 1}}},
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		format        string
+		expectedValue string
+	}{
+		{
+			name:   "JSON",
+			format: FormatJSON,
+			expectedValue: `"files": [
+    {
+      "path": "a.csv",
+      "distinct_domains": 1,
+      "rows_read": 2,
+      "rows_rejected": 0,
+      "duration": "0s"
+    },`,
+		},
+		{
+			name:   "Table",
+			format: FormatTable,
+			expectedValue: `Files:
+  a.csv: 2 rows read, 0 rejected, 1 domains
+  b.csv: 1 rows read, 0 rejected, 1 domains
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			writer, err := NewResultWriter(tc.format)
+			if err != nil {
+				t.Fatalf("Error creating result writer: %v", err)
+			}
+			var buf bytes.Buffer
+
+			// When
+			err = writer.Write(&buf, result)
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if !strings.Contains(buf.String(), tc.expectedValue) {
+				t.Errorf("Test %s failed. Expected: %q, Got: %q", tc.name, tc.expectedValue, buf.String())
+			}
+		})
+	}
+}
+
+func TestResultWritersSubdomains(t *testing.T) {
+	result := &Result{
+		Domains: []DomainCount{
+			{Domain: "google.com", Count: 5, Subdomains: []DomainCount{
+				{Domain: "google.com", Count: 3},
+				{Domain: "mail.google.com", Count: 2},
+			}},
+		},
+		DistinctDomains: 1,
+		Stats:           Stats{RowsRead: 5},
+	}
+
+	testCases := []struct {
+		name          string
+		format        string
+		expectedValue string
+	}{
+		{
+			name:   "CSV",
+			format: FormatCSV,
+			expectedValue: `registrable_domain,domain,count
+google.com,google.com,3
+google.com,mail.google.com,2
+`,
+		},
+		{
+			name:   "Table",
+			format: FormatTable,
+			expectedValue: `DOMAIN             COUNT
+google.com             5
+  google.com           3
+  mail.google.com      2
+`,
+		},
+		{
+			name:          "NDJSON",
+			format:        FormatNDJSON,
+			expectedValue: `{"domain":"google.com","count":5,"subdomains":[{"domain":"google.com","count":3},{"domain":"mail.google.com","count":2}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			writer, err := NewResultWriter(tc.format)
+			if err != nil {
+				t.Fatalf("Error creating result writer: %v", err)
+			}
+			var buf bytes.Buffer
+
+			// When
+			err = writer.Write(&buf, result)
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if !strings.HasPrefix(buf.String(), tc.expectedValue) {
+				t.Errorf("Test %s failed. Expected: %q, Got: %q", tc.name, tc.expectedValue, buf.String())
+			}
+		})
+	}
+}
+
+func TestResultWritersDeduplicated(t *testing.T) {
+	result := &Result{
+		Domains:         []DomainCount{{Domain: "gmail.com", Count: 12, Unique: 9}},
+		DistinctDomains: 1,
+		Stats:           Stats{RowsRead: 12},
+		Deduplicated:    true,
+		UniqueCustomers: 9,
+	}
+
+	testCases := []struct {
+		name          string
+		format        string
+		expectedValue string
+	}{
+		{
+			name:   "CSV",
+			format: FormatCSV,
+			expectedValue: `domain,count,unique
+gmail.com,12,9
+`,
+		},
+		{
+			name:   "Table",
+			format: FormatTable,
+			expectedValue: `DOMAIN     COUNT  UNIQUE
+gmail.com     12       9
+
+Domains:        1
+Rows read:      12
+Rows rejected:  0
+Unique:         9
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			writer, err := NewResultWriter(tc.format)
+			if err != nil {
+				t.Fatalf("Error creating result writer: %v", err)
+			}
+			var buf bytes.Buffer
+
+			// When
+			err = writer.Write(&buf, result)
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if !strings.HasPrefix(buf.String(), tc.expectedValue) {
+				t.Errorf("Test %s failed. Expected: %q, Got: %q", tc.name, tc.expectedValue, buf.String())
+			}
+		})
+	}
+}
+
+func TestResultWritersGrouped(t *testing.T) {
+	result := &Result{
+		Domains: []DomainCount{
+			{Key: []string{"github.io", "Male"}, Count: 2},
+			{Key: []string{"github.io", "Female"}, Count: 1},
+		},
+		DistinctDomains: 2,
+		Stats:           Stats{RowsRead: 3},
+		GroupBy:         []string{GroupKeyDomain, "column:gender"},
+	}
+
+	testCases := []struct {
+		name          string
+		format        string
+		expectedValue string
+	}{
+		{
+			name:   "CSV",
+			format: FormatCSV,
+			expectedValue: `domain,gender,count
+github.io,Male,2
+github.io,Female,1
+`,
+		},
+		{
+			name:   "Table",
+			format: FormatTable,
+			expectedValue: `DOMAIN     GENDER  COUNT
+github.io  Male        2
+github.io  Female      1
+
+Groups:         2
+`,
+		},
+		{
+			name:          "NDJSON",
+			format:        FormatNDJSON,
+			expectedValue: `{"key":["github.io","Male"],"count":2}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			writer, err := NewResultWriter(tc.format)
+			if err != nil {
+				t.Fatalf("Error creating result writer: %v", err)
+			}
+			var buf bytes.Buffer
+
+			// When
+			err = writer.Write(&buf, result)
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if !strings.HasPrefix(buf.String(), tc.expectedValue) {
+				t.Errorf("Test %s failed. Expected: %q, Got: %q", tc.name, tc.expectedValue, buf.String())
+			}
+		})
+	}
+}
+
+func TestTableResultWriterEstimatedUnique(t *testing.T) {
+	// Given
+	result := &Result{Deduplicated: true, UniqueCustomers: 3010, UniqueError: hllStdError(DefaultHLLPrecision)}
+	var buf bytes.Buffer
+
+	// When
+	err := tableResultWriter{}.Write(&buf, result)
+
+	// Then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "Unique:         ~3010 (±0.81% standard error)\n"
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("Unexpected table. Expected: %q, Got: %q", expected, buf.String())
+	}
+}
+
+func TestNewResultWriterUnknownFormat(t *testing.T) {
+	// Given, When
+	writer, err := NewResultWriter("xml")
+
+	// Then
+	if err == nil || writer != nil {
+		t.Errorf("Unexpected result. Expected an error, Got: %v, %v", writer, err)
+	}
+}
+
+func TestNewResultWriterEmptyFormat(t *testing.T) {
+	// Given, When
+	writer, err := NewResultWriter("")
+
+	// Then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if writer != (tableResultWriter{}) {
+		t.Errorf("Unexpected writer. Expected: %T, Got: %T", tableResultWriter{}, writer)
+	}
+}
+
+func TestWriteResultToFile(t *testing.T) {
+	// Given
+	config := &Config{OutputFormat: FormatCSV, OutputFilePath: filepath.Join(t.TempDir(), "domains.csv")}
+	result := &Result{Domains: []DomainCount{{Domain: "github.io", Count: 3}}}
+
+	// When
+	err := WriteResult(config, result)
+
+	// Then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(config.OutputFilePath)
+	if err != nil {
+		t.Fatalf("Error reading output file: %v", err)
+	}
+
+	expected := "domain,count\ngithub.io,3\n"
+	if string(content) != expected {
+		t.Errorf("Unexpected output file. Expected: %q, Got: %q", expected, string(content))
+	}
+}
@@ -0,0 +1,112 @@
+package customerimporter
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Reasons a CSV record gets rejected, used to group the errors in the result.
+const (
+	ReasonMalformedRow  = "malformed row"
+	ReasonShortRow      = "short row"
+	ReasonInvalidEmail  = "invalid email format"
+	ReasonInvalidDomain = "invalid domain"
+)
+
+// RowError describes a rejected CSV record: its line number, the offending field and value and the reason of the rejection.
+type RowError struct {
+	Line   int
+	Field  string
+	Value  string
+	Reason string
+
+	record []string // The original record, written to the rejects file.
+	err    error    // The underlying error, if any.
+}
+
+// Error returns the row error message including its line number.
+func (e *RowError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Reason, e.Value)
+	}
+	return fmt.Sprintf("line %d: %s: %s %q", e.Line, e.Reason, e.Field, e.Value)
+}
+
+// Unwrap returns the underlying error.
+func (e *RowError) Unwrap() error {
+	return e.err
+}
+
+// newParseRowError turns an error returned by the CSV reader into a RowError. It returns false for
+// errors which aren't related to a single record (e.g. I/O errors).
+func newParseRowError(err error, record []string) (*RowError, bool) {
+	var parseErr *csv.ParseError
+	if !errors.As(err, &parseErr) {
+		return nil, false
+	}
+
+	return &RowError{
+		Line:   parseErr.StartLine,
+		Value:  parseErr.Err.Error(),
+		Reason: ReasonMalformedRow,
+		record: record,
+		err:    err,
+	}, true
+}
+
+// rejectsWriter writes the rejected records along with the reason of the rejection as a CSV file.
+type rejectsWriter struct {
+	writer *csv.Writer
+}
+
+// newRejectsWriter creates a rejectsWriter and writes the header line: the input file's header with an extra reason column.
+// The rejects are written with the input file's delimiter, so they can be fixed and imported again.
+func newRejectsWriter(w io.Writer, header []string, delimiter rune) (*rejectsWriter, error) {
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiterOrDefault(delimiter)
+	if err := writer.Write(append(append([]string{}, header...), "reason")); err != nil {
+		return nil, err
+	}
+
+	return &rejectsWriter{writer: writer}, nil
+}
+
+// Write writes the original record of the row error followed by its message.
+func (r *rejectsWriter) Write(rowErr *RowError) error {
+	return r.writer.Write(append(append([]string{}, rowErr.record...), rowErr.Error()))
+}
+
+// Flush writes any buffered data and returns the first error which occurred while writing.
+func (r *rejectsWriter) Flush() error {
+	r.writer.Flush()
+	return r.writer.Error()
+}
+
+// rejectsFileSuffix ends the name of the rejects files written alongside the input files.
+const rejectsFileSuffix = ".rejects.csv"
+
+// rejectsFilePath returns the path of the rejects file of the input file: REJECTS_CSV_FILE_PATH if set, otherwise
+// an uncompressed CSV file alongside the input file, e.g. customers.rejects.csv for customers.csv or
+// customers.csv.gz. It returns an empty string when rejects aren't written (there is no file alongside the standard
+// input).
+func rejectsFilePath(config *Config, inputPath string) string {
+	if config.RejectsCSVFilePath != "" {
+		return config.RejectsCSVFilePath
+	}
+	if !config.WriteRejects || inputPath == StdinPath {
+		return ""
+	}
+
+	base := inputPath
+	for _, extension := range compressionExtensions {
+		if strings.HasSuffix(base, extension) {
+			base = strings.TrimSuffix(base, extension)
+			break
+		}
+	}
+	return strings.TrimSuffix(base, filepath.Ext(base)) + rejectsFileSuffix
+}
@@ -0,0 +1,198 @@
+package customerimporter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRejectsWriter(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	config.Concurrency = 1 // Keep the rejected rows in the input order.
+	config.FieldsPerRecord = -1
+
+	reader, err := createCSVfileReader(log, config, strings.NewReader(`first_name,last_name,email,gender,ip_address
+Mildred,Hernandez,mhernandez0@github.io,Female,38.194.51.128
+Bonnie,Ortiz,bortiz1.github.com,Female,197.54.209.129
+Dennis,Henry
+`))
+	if err != nil {
+		t.Fatalf("Error creating CSV file reader: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rejects, err := newRejectsWriter(&buf, reader.header, 0)
+	if err != nil {
+		t.Fatalf("Error creating rejects writer: %v", err)
+	}
+
+	// When
+	_, _, err = processEmailDomainsConcurrently(context.Background(), log, config, reader, rejects, nil)
+	if err != nil {
+		t.Fatalf("Error processing email domains: %v", err)
+	}
+
+	// Then
+	expected := `first_name,last_name,email,gender,ip_address,reason
+Bonnie,Ortiz,bortiz1.github.com,Female,197.54.209.129,"line 3: invalid email format: email ""bortiz1.github.com"""
+Dennis,Henry,"line 4: short row: row has too few fields: got 2, expected at least 5"
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected rejects file. Expected: %q, Got: %q", expected, buf.String())
+	}
+}
+
+func TestRowError(t *testing.T) {
+	testCases := []struct {
+		name          string
+		rowErr        *RowError
+		expectedValue string
+		expectedErr   error
+	}{
+		{
+			name:          "Field error",
+			rowErr:        &RowError{Line: 7, Field: FieldEmail, Value: "bortiz1.github.com", Reason: ReasonInvalidEmail},
+			expectedValue: `line 7: invalid email format: email "bortiz1.github.com"`,
+		},
+		{
+			name:          "Row error",
+			rowErr:        &RowError{Line: 3, Value: "row has too few fields", Reason: ReasonShortRow, err: ErrShortRow},
+			expectedValue: "line 3: short row: row has too few fields",
+			expectedErr:   ErrShortRow,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given, When
+			message := tc.rowErr.Error()
+
+			// Then
+			if message != tc.expectedValue {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, message)
+			}
+			if tc.expectedErr != nil && !errors.Is(tc.rowErr, tc.expectedErr) {
+				t.Errorf("Test %s failed. Expected wrapped error: %v, Got: %v", tc.name, tc.expectedErr, tc.rowErr.Unwrap())
+			}
+		})
+	}
+}
+
+func TestRejectsFilePath(t *testing.T) {
+	testCases := []struct {
+		name          string
+		config        *Config
+		inputPath     string
+		expectedValue string
+	}{
+		{
+			name:          "Rejects not written",
+			config:        &Config{},
+			inputPath:     "data/customers.csv",
+			expectedValue: "",
+		},
+		{
+			name:          "Alongside the input file",
+			config:        &Config{WriteRejects: true},
+			inputPath:     "data/customers.csv",
+			expectedValue: "data/customers.rejects.csv",
+		},
+		{
+			name:          "Alongside a gzip file",
+			config:        &Config{WriteRejects: true},
+			inputPath:     "data/customers.csv.gz",
+			expectedValue: "data/customers.rejects.csv",
+		},
+		{
+			name:          "Alongside a bzip2 file",
+			config:        &Config{WriteRejects: true},
+			inputPath:     "data/customers.csv.bz2",
+			expectedValue: "data/customers.rejects.csv",
+		},
+		{
+			name:          "Alongside a zstd file",
+			config:        &Config{WriteRejects: true},
+			inputPath:     "data/customers.csv.zst",
+			expectedValue: "data/customers.rejects.csv",
+		},
+		{
+			name:          "Alongside a file with another extension",
+			config:        &Config{WriteRejects: true},
+			inputPath:     "data/customers.tsv",
+			expectedValue: "data/customers.rejects.csv",
+		},
+		{
+			name:          "Alongside a file without extension",
+			config:        &Config{WriteRejects: true},
+			inputPath:     "data/customers",
+			expectedValue: "data/customers.rejects.csv",
+		},
+		{
+			name:          "Standard input",
+			config:        &Config{WriteRejects: true},
+			inputPath:     StdinPath,
+			expectedValue: "",
+		},
+		{
+			name:          "Explicit path",
+			config:        &Config{RejectsCSVFilePath: "/tmp/rejects.csv"},
+			inputPath:     "data/customers.csv",
+			expectedValue: "/tmp/rejects.csv",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given, When
+			path := rejectsFilePath(tc.config, tc.inputPath)
+
+			// Then
+			if !reflect.DeepEqual(path, tc.expectedValue) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, path)
+			}
+		})
+	}
+}
+
+func TestProcessEmailDomainsConcurrentlyReaderFailure(t *testing.T) {
+	// Given
+	log := NewMockLogger()
+	config, err := LoadConfigTest(log, "./.env")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	readErr := errors.New("disk failure")
+	input := io.MultiReader(strings.NewReader("first_name,last_name,email,gender,ip_address\nMildred,Hernandez,mhernandez0@github.io,Female,38.194.51.128\n"), &failingReader{err: readErr})
+
+	reader, err := createCSVfileReader(log, config, input)
+	if err != nil {
+		t.Fatalf("Error creating CSV file reader: %v", err)
+	}
+
+	// When
+	_, _, err = processEmailDomainsConcurrently(context.Background(), log, config, reader, nil, nil)
+
+	// Then
+	if !errors.Is(err, readErr) {
+		t.Errorf("Unexpected error. Expected: %v, Got: %v", readErr, err)
+	}
+}
+
+// failingReader is an io.Reader which always fails with the given error.
+type failingReader struct {
+	err error
+}
+
+// Read returns the failingReader's error.
+func (r *failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,117 @@
+package customerimporter
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+)
+
+// Sort orders of the email domains. Ties in the count orders are broken by the domain name.
+const (
+	SortNameAsc   = "name-asc"
+	SortNameDesc  = "name-desc"
+	SortCountAsc  = "count-asc"
+	SortCountDesc = "count-desc"
+)
+
+// DefaultSortOrder is the sort order used when SORT_ORDER isn't set.
+const DefaultSortOrder = SortNameAsc
+
+// SortOrders lists the supported sort orders.
+var SortOrders = []string{SortNameAsc, SortNameDesc, SortCountAsc, SortCountDesc}
+
+// domainLess returns the function reporting whether the domain a goes before the domain b in the given sort order.
+// An empty order stands for the default one.
+func domainLess(order string) (func(a, b DomainCount) bool, error) {
+	switch order {
+	case SortNameAsc, "":
+		return func(a, b DomainCount) bool { return a.Domain < b.Domain }, nil
+	case SortNameDesc:
+		return func(a, b DomainCount) bool { return a.Domain > b.Domain }, nil
+	case SortCountAsc:
+		return func(a, b DomainCount) bool {
+			if a.Count != b.Count {
+				return a.Count < b.Count
+			}
+			return a.Domain < b.Domain
+		}, nil
+	case SortCountDesc:
+		return func(a, b DomainCount) bool {
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return a.Domain < b.Domain
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown sort order %q, expected one of %q", order, SortOrders)
+	}
+}
+
+// sortDomainCounts returns the email domains with their occurrences in the given order. A positive top limits the
+// result to the first top domains without sorting all of them.
+func sortDomainCounts(emailDomains map[string]int, order string, top int) ([]DomainCount, error) {
+	less, err := domainLess(order)
+	if err != nil {
+		return nil, err
+	}
+
+	if top > 0 && top < len(emailDomains) {
+		return topDomains(emailDomains, less, top), nil
+	}
+
+	return sortAllDomains(emailDomains, less), nil
+}
+
+// topDomains returns the first top domains in the order given by less, sorted. It keeps a heap of at most top
+// domains instead of sorting all of them, so it takes O(n log top) time.
+func topDomains(emailDomains map[string]int, less func(a, b DomainCount) bool, top int) []DomainCount {
+	h := &domainHeap{domains: make([]DomainCount, 0, top), less: less}
+	for domain, count := range emailDomains {
+		domainCount := DomainCount{Domain: domain, Count: count}
+		if h.Len() < top {
+			heap.Push(h, domainCount)
+			continue
+		}
+		if less(domainCount, h.domains[0]) { // Goes before the last of the current top domains.
+			h.domains[0] = domainCount
+			heap.Fix(h, 0)
+		}
+	}
+
+	// The root of the heap is the last domain, so popping fills the slice from its end.
+	sortedDomains := make([]DomainCount, h.Len())
+	for i := len(sortedDomains) - 1; i >= 0; i-- {
+		sortedDomains[i] = heap.Pop(h).(DomainCount)
+	}
+
+	return sortedDomains
+}
+
+// sortAllDomains returns all the domains in the order given by less.
+func sortAllDomains(emailDomains map[string]int, less func(a, b DomainCount) bool) []DomainCount {
+	sortedDomains := make([]DomainCount, 0, len(emailDomains))
+	for domain, count := range emailDomains {
+		sortedDomains = append(sortedDomains, DomainCount{Domain: domain, Count: count})
+	}
+
+	sort.Slice(sortedDomains, func(i, j int) bool { return less(sortedDomains[i], sortedDomains[j]) })
+
+	return sortedDomains
+}
+
+// domainHeap is a heap.Interface of domains with the domain going last in the sort order at the root.
+type domainHeap struct {
+	domains []DomainCount
+	less    func(a, b DomainCount) bool
+}
+
+func (h *domainHeap) Len() int           { return len(h.domains) }
+func (h *domainHeap) Less(i, j int) bool { return h.less(h.domains[j], h.domains[i]) }
+func (h *domainHeap) Swap(i, j int)      { h.domains[i], h.domains[j] = h.domains[j], h.domains[i] }
+func (h *domainHeap) Push(x any)         { h.domains = append(h.domains, x.(DomainCount)) }
+
+func (h *domainHeap) Pop() any {
+	last := h.domains[len(h.domains)-1]
+	h.domains = h.domains[:len(h.domains)-1]
+	return last
+}
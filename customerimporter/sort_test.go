@@ -0,0 +1,133 @@
+package customerimporter
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestSortDomainCountsOrders(t *testing.T) {
+	emailDomains := map[string]int{
+		"github.io":       5,
+		"github.com":      2,
+		"hubpages.com":    1,
+		"statcounter.com": 7,
+		"rediff.com":      2,
+		"cnet.com":        2,
+	}
+
+	testCases := []struct {
+		name          string
+		order         string
+		top           int
+		expectedValue []string
+	}{
+		{
+			name:          "Name ascending",
+			order:         SortNameAsc,
+			expectedValue: []string{"cnet.com", "github.com", "github.io", "hubpages.com", "rediff.com", "statcounter.com"},
+		},
+		{
+			name:          "Default order",
+			order:         "",
+			expectedValue: []string{"cnet.com", "github.com", "github.io", "hubpages.com", "rediff.com", "statcounter.com"},
+		},
+		{
+			name:          "Name descending",
+			order:         SortNameDesc,
+			expectedValue: []string{"statcounter.com", "rediff.com", "hubpages.com", "github.io", "github.com", "cnet.com"},
+		},
+		{
+			name:          "Count ascending, ties broken by name",
+			order:         SortCountAsc,
+			expectedValue: []string{"hubpages.com", "cnet.com", "github.com", "rediff.com", "github.io", "statcounter.com"},
+		},
+		{
+			name:          "Count descending, ties broken by name",
+			order:         SortCountDesc,
+			expectedValue: []string{"statcounter.com", "github.io", "cnet.com", "github.com", "rediff.com", "hubpages.com"},
+		},
+		{
+			name:          "Top 3 by count descending",
+			order:         SortCountDesc,
+			top:           3,
+			expectedValue: []string{"statcounter.com", "github.io", "cnet.com"},
+		},
+		{
+			name:          "Top 2 by count ascending",
+			order:         SortCountAsc,
+			top:           2,
+			expectedValue: []string{"hubpages.com", "cnet.com"},
+		},
+		{
+			name:          "Top above the number of domains",
+			order:         SortNameDesc,
+			top:           10,
+			expectedValue: []string{"statcounter.com", "rediff.com", "hubpages.com", "github.io", "github.com", "cnet.com"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given, When
+			domainCounts, err := sortDomainCounts(emailDomains, tc.order, tc.top)
+
+			// Then
+			if err != nil {
+				t.Fatalf("Test %s failed. Unexpected error: %v", tc.name, err)
+			}
+			if sortedDomains := domainNames(domainCounts); !reflect.DeepEqual(sortedDomains, tc.expectedValue) {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedValue, sortedDomains)
+			}
+		})
+	}
+}
+
+func TestTopDomainsMatchesFullSort(t *testing.T) {
+	// Given
+	random := rand.New(rand.NewSource(1))
+	emailDomains := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		emailDomains[fmt.Sprintf("domain%d.com", i)] = random.Intn(100)
+	}
+
+	for _, order := range SortOrders {
+		for _, top := range []int{1, 20, 999} {
+			t.Run(fmt.Sprintf("%s top %d", order, top), func(t *testing.T) {
+				less, err := domainLess(order)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				// When
+				topSorted := topDomains(emailDomains, less, top)
+
+				// Then
+				expected := sortAllDomains(emailDomains, less)[:top]
+				if !reflect.DeepEqual(topSorted, expected) {
+					t.Errorf("Unexpected top domains. Expected: %v, Got: %v", expected, topSorted)
+				}
+			})
+		}
+	}
+}
+
+func TestSortDomainCountsUnknownOrder(t *testing.T) {
+	// Given, When
+	domainCounts, err := sortDomainCounts(map[string]int{"github.com": 1}, "random", 0)
+
+	// Then
+	if err == nil || domainCounts != nil {
+		t.Errorf("Unexpected result. Expected an error, Got: %v, %v", domainCounts, err)
+	}
+}
+
+// domainNames returns the domains of the domain counts, in their order.
+func domainNames(domainCounts []DomainCount) []string {
+	names := make([]string, 0, len(domainCounts))
+	for _, domainCount := range domainCounts {
+		names = append(names, domainCount.Domain)
+	}
+	return names
+}
@@ -1,5 +1,12 @@
 package customerimporter
 
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"time"
+)
+
 // Customer struct represents a customer record in the CSV file.
 type Customer struct {
 	FirstName string
@@ -21,15 +28,120 @@ type MockLogger struct {
 	Logs []string
 }
 
-// Task is a struct of CSV file records (size of this slice depends of the reader's buffer).
+// csvFileReader is a CSV reader along with the position of the customer's fields resolved from the header line.
+type csvFileReader struct {
+	*csv.Reader
+	columns     columnMapping
+	header      []string
+	compression string         // Compression format of the input, see detectCompression.
+	closer      io.Closer      // Releases the decompressor, if any.
+	chunks      []recordSource // Readers of the byte ranges of the file, when it is read in chunks.
+	mapped      []byte         // Mapped bytes following the header line, when the file is memory-mapped.
+	buffered    *bufio.Reader  // Reader of the data following the header line, nil if the csv.Reader may have buffered it.
+	headerLines int            // Lines read along with the header line.
+}
+
+// Close releases the decompressor of the input. It doesn't close the input itself.
+func (r *csvFileReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Task is a batch of up to Config.BatchSize CSV file records along with their line numbers. With the fast path, most
+// of the rows are in the fast batch instead.
 type Task struct {
-	record []string
+	records [][]string
+	lines   []int
+	fast    *fastBatch
 }
 
-// DomainCounter is a struct made for convenience for the results channel.
+// newTask returns an empty Task with room for a batch of the given size, in its records or, with the fast path, in a
+// fast batch taken from the pool.
+func newTask(batchSize int, fast bool) Task {
+	if fast {
+		return Task{fast: getFastBatch(batchSize)}
+	}
+	return Task{records: make([][]string, 0, batchSize), lines: make([]int, 0, batchSize)}
+}
+
+// size returns the number of rows of the task.
+func (t Task) size() int {
+	if t.fast != nil {
+		return len(t.records) + len(t.fast.rows)
+	}
+	return len(t.records)
+}
+
+// DomainCounter is the canonical email of a customer along with the domain (or the composite key when grouping by
+// other keys) it was counted in, sent to the collector when deduplicating customers.
 type DomainCounter struct {
-	domain  string
-	counter int
+	domain string
+	email  string
+}
+
+// workerTotals holds what a worker counted, merged once all the workers are done.
+type workerTotals struct {
+	counts   map[string]int // Occurrences of the domains or composite keys.
+	filtered int            // Valid rows left out by the filter.
+}
+
+// DomainCount is an email domain along with the number of customers with e-mail addresses for it.
+// When both the registrable domains and the exact domains are reported, Subdomains holds the exact domains of the
+// registrable domain. When the customers are grouped by other keys (see Config.GroupBy), Key holds the values of the
+// group keys instead of Domain.
+type DomainCount struct {
+	Domain     string        `json:"domain,omitempty"`
+	Key        []string      `json:"key,omitempty"`
+	Count      int           `json:"count"`
+	Unique     int           `json:"unique,omitempty"` // Unique customers, when deduplicating customers.
+	Subdomains []DomainCount `json:"subdomains,omitempty"`
+}
+
+// Stats holds the totals collected while processing the CSV file records.
+type Stats struct {
+	RowsRead       int
+	RowsRejected   int
+	RowsFiltered   int            // Valid rows left out by Config.Filter, not counted as rejected.
+	ErrorsByReason map[string]int // Number of rejected rows grouped by the RowError reason.
+}
+
+// add adds the totals of other to the stats.
+func (s *Stats) add(other Stats) {
+	s.RowsRead += other.RowsRead
+	s.RowsRejected += other.RowsRejected
+	s.RowsFiltered += other.RowsFiltered
+	for reason, count := range other.ErrorsByReason {
+		if s.ErrorsByReason == nil {
+			s.ErrorsByReason = make(map[string]int)
+		}
+		s.ErrorsByReason[reason] += count
+	}
+}
+
+// Result is the outcome of the import: email domains in the configured order with their occurrences and the import totals.
+type Result struct {
+	Domains         []DomainCount
+	DistinctDomains int // Number of distinct domains found, Domains may hold fewer of them when limited by Config.Top.
+	Stats
+	Duration time.Duration
+	Files    []FileResult // Subtotals of each input file imported by RunFiles.
+	GroupBy  []string     // Group keys of Domains, empty when they are the email domains.
+
+	// Deduplicated is set when the customers are deduplicated: DomainCount.Unique holds the unique customers of the
+	// domains and UniqueCustomers their total. The subtotals of the files don't hold unique counts. A customer found
+	// in several domains is counted in the smallest of them by DedupModeExact, but in each of them by DedupModeHLL,
+	// whose unique counts of the domains may add up to more than UniqueCustomers.
+	Deduplicated    bool
+	UniqueCustomers int
+	UniqueError     float64 // Relative standard error of the unique counts when estimated by DedupModeHLL, 0 if exact.
+}
+
+// FileResult holds the subtotals of one of the input files.
+type FileResult struct {
+	Path string
+	Result
 }
 
 // Config is a struct which encapsulates .env file variables.
@@ -41,4 +153,36 @@ type Config struct {
 	InputCSVFilePath3kLines  string
 	InputCSVFilePath10mLines string
 	ReadBufferSizeInBytes    int
+	BatchSize                int    // Records sent to the workers at once, 0 for DefaultBatchSize.
+	ReaderMode               string // Whether the files are read by one goroutine, in chunks or memory-mapped, see ReaderModes.
+	FastPath                 bool   // Scan the email field out of the rows without quotes instead of parsing them into records.
+	ColumnAliases            map[string][]string
+	InputEncoding            string // Encoding of the input, e.g. windows-1252, decoded into UTF-8. Empty for UTF-8.
+	Delimiter                rune   // Field delimiter, 0 for the default comma.
+	SniffDelimiter           bool   // Guess the delimiter from the first lines instead of using Delimiter.
+	Comment                  rune   // Lines starting with the comment character are skipped, 0 for none.
+	LazyQuotes               bool
+	TrimLeadingSpace         bool
+	KeepBOM                  bool // Keep the UTF-8 byte order mark at the start of the input instead of stripping it.
+	NoHeader                 bool // The input has no header line, the columns are in the default order.
+	FieldsPerRecord          int
+	WriteRejects             bool
+	RejectsCSVFilePath       string
+	EmailValidation          string         // Email validation mode, see EmailValidations.
+	EmailValidator           EmailValidator // Validates the emails instead of the EmailValidation mode when set in code.
+	DomainForm               string         // Form of the internationalized domains in the result, see DomainForms.
+	Dedup                    bool           // Count the unique customers per domain along with the rows.
+	DedupMode                string         // Whether the unique customers are counted exactly or estimated, see DedupModes.
+	DedupRules               []string       // Canonicalization rules of the emails, see DedupRules.
+	DedupMaxInMemory         int            // Distinct emails kept in memory before spilling them to disk.
+	DedupSpillDir            string         // Directory of the spill files, the system's temporary directory if empty.
+	HLLPrecision             int            // Precision of the HyperLogLog sketches, 0 for DefaultHLLPrecision.
+	Aggregation              string         // Whether the exact or the registrable domains are counted, see Aggregations.
+	GroupBy                  []string       // Keys the customers are counted by, see GroupKeys. Empty for the domain.
+	Filter                   string         // Expression the valid rows must match to be counted, see compileFilter.
+	OutputFormat             string
+	OutputFilePath           string
+	SortOrder                string
+	Top                      int
+	Timeout                  time.Duration
 }
@@ -2,4 +2,9 @@ module github.com/pawlobanano/csv-reader
 
 go 1.21.2
 
-require github.com/joho/godotenv v1.5.1
+require (
+	github.com/joho/godotenv v1.5.1
+	github.com/klauspost/compress v1.17.11
+	golang.org/x/net v0.34.0
+	golang.org/x/text v0.21.0
+)
@@ -1,29 +1,249 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/pawlobanano/csv-reader/customerimporter"
 )
 
-var log = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+// Exit codes of the program.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+
+	exitInterrupted = 130 // Conventional exit code of a program stopped by SIGINT.
+)
+
+const usage = `Usage: csv-reader [flags] [input ...]
+
+Counts the customers per e-mail domain in the given CSV files, merged into one
+report. Inputs may be glob patterns, e.g. "data/*.csv". Use "-" to read from
+the standard input. Without inputs INPUT_CSV_FILE_PATH_DEFAULT is used.
+
+Flags override environment variables, which override the .env file.
+
+Flags:
+`
+
+// Diagnostic logs go to stderr, the domain report goes to stdout or the output file.
+var log = slog.New(slog.NewJSONHandler(os.Stderr, nil))
 
 func main() {
-	config, err := customerimporter.LoadConfig(log, ".env")
+	os.Exit(run(os.Args[1:]))
+}
+
+// run parses the command-line arguments, imports the inputs and writes the domain report. It returns the exit code.
+func run(args []string) int {
+	flags := flag.NewFlagSet("csv-reader", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+
+	var (
+		concurrency      = flags.Int("concurrency", 0, "number of worker goroutines (CONCURRENCY)")
+		bufferSize       = flags.Int("buffer-size", 0, "read buffer size in bytes (READ_BUFFER_SIZE_IN_BYTES)")
+		readerMode       = flags.String("reader-mode", "", "read the files with one goroutine, in chunks with one goroutine each, or memory-mapped in chunks: buffered, chunked or mmap (READER_MODE, default buffered)")
+		fastPath         = flags.Bool("fast-path", false, "scan the email field out of the rows without quotes instead of parsing them (FAST_PATH)")
+		batchSize        = flags.Int("batch-size", 0, "records sent to a worker at once (BATCH_SIZE, default 256)")
+		outputPath       = flags.String("output", "", "write the report to the given file instead of stdout (OUTPUT_FILE_PATH)")
+		format           = flags.String("format", "", "report format: json, csv, ndjson or table (OUTPUT_FORMAT, default table)")
+		sortOrder        = flags.String("sort", "", "domain order: name-asc, name-desc, count-asc or count-desc (SORT_ORDER, default name-asc)")
+		top              = flags.Int("top", 0, "report only the first N domains in the sort order, 0 for all (TOP)")
+		timeout          = flags.Duration("timeout", 0, "stop the import after the given duration, e.g. 30s, 0 for no timeout (TIMEOUT)")
+		emailValidation  = flags.String("email-validation", "", "email validation: lenient or strict RFC 5322 (EMAIL_VALIDATION, default lenient)")
+		dedup            = flags.Bool("dedup", false, "count the unique customers per domain too (DEDUP)")
+		dedupRules       = flags.String("dedup-rules", "", "comma-separated email canonicalization rules: gmail, plus or none (DEDUP_RULES, default gmail)")
+		dedupMode        = flags.String("dedup-mode", "", "count the unique customers exactly or estimate them: exact or hll, implies --dedup (DEDUP_MODE, default exact)")
+		hllPrecision     = flags.Int("hll-precision", 0, "precision of the HyperLogLog sketches, 4 to 18 (HLL_PRECISION, default 14)")
+		filter           = flags.String("filter", "", "count only the customers matching the expression, e.g. 'gender == Female and not ip_address in 10.0.0.0/8' (FILTER)")
+		groupBy          = flags.String("group-by", "", "comma-separated keys to count the customers by: domain, gender, ip_prefix, last_initial or column:<name> (GROUP_BY, default domain)")
+		aggregation      = flags.String("aggregate", "", "count the exact domains, the registrable domains (eTLD+1) or both (DOMAIN_AGGREGATION, default exact)")
+		domainForm       = flags.String("domain-form", "", "form of the internationalized domains: punycode or unicode (DOMAIN_FORM, default punycode)")
+		inputEncoding    = flags.String("encoding", "", "encoding of the inputs, e.g. windows-1252 or iso-8859-2 (INPUT_ENCODING, default utf-8)")
+		delimiter        = flags.String("delimiter", "", "field delimiter, e.g. ';' or tab (CSV_DELIMITER, default ',')")
+		sniffDelimiter   = flags.Bool("sniff-delimiter", false, "guess the field delimiter from the first lines (CSV_SNIFF_DELIMITER)")
+		comment          = flags.String("comment", "", "skip the lines starting with the given character, e.g. '#' (CSV_COMMENT)")
+		lazyQuotes       = flags.Bool("lazy-quotes", false, "allow quotes in unquoted fields (CSV_LAZY_QUOTES)")
+		trimLeadingSpace = flags.Bool("trim-leading-space", false, "ignore the leading white space of the fields (CSV_TRIM_LEADING_SPACE)")
+		keepBOM          = flags.Bool("keep-bom", false, "keep the UTF-8 byte order mark instead of stripping it (CSV_STRIP_BOM=false)")
+		noHeader         = flags.Bool("no-header", false, "the inputs have no header line, the columns are in the default order (CSV_HAS_HEADER=false)")
+		configPath       = flags.String("config", ".env", "path of the .env config file, optional unless given explicitly")
+	)
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	required := false // The default .env file is optional.
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "config" { // An explicitly given config file must exist.
+			required = true
+		}
+	})
+
+	// The config is validated once the flags override it, so a flag can fix an invalid variable.
+	config, err := customerimporter.ParseConfig(log, *configPath, required)
 	if err != nil {
-		log.Error("Loading config failed.", err)
-		return
+		log.Error("Loading config failed.", slog.Any("error", err))
+		return exitError
 	}
 
-	start := time.Now()
+	// Only the flags given explicitly override the config.
+	var flagErrs []error
+	flags.Visit(func(f *flag.Flag) {
+		var err error
+		switch f.Name {
+		case "concurrency":
+			config.Concurrency = *concurrency
+		case "buffer-size":
+			config.ReadBufferSizeInBytes = *bufferSize
+		case "reader-mode":
+			config.ReaderMode = *readerMode
+		case "fast-path":
+			config.FastPath = *fastPath
+		case "batch-size":
+			config.BatchSize = *batchSize
+		case "output":
+			config.OutputFilePath = *outputPath
+		case "format":
+			config.OutputFormat = *format
+		case "sort":
+			config.SortOrder = *sortOrder
+		case "top":
+			config.Top = *top
+		case "timeout":
+			config.Timeout = *timeout
+		case "email-validation":
+			config.EmailValidation = *emailValidation
+		case "dedup":
+			config.Dedup = *dedup
+		case "dedup-rules":
+			config.DedupRules = customerimporter.ParseList(*dedupRules)
+		case "dedup-mode":
+			config.DedupMode = *dedupMode
+			config.Dedup = true
+		case "hll-precision":
+			config.HLLPrecision = *hllPrecision
+		case "filter":
+			config.Filter = *filter
+		case "group-by":
+			config.GroupBy = customerimporter.ParseList(*groupBy)
+		case "aggregate":
+			config.Aggregation = *aggregation
+		case "domain-form":
+			config.DomainForm = *domainForm
+		case "encoding":
+			config.InputEncoding = *inputEncoding
+		case "delimiter":
+			config.Delimiter, err = customerimporter.ParseCSVRune(*delimiter)
+		case "sniff-delimiter":
+			config.SniffDelimiter = *sniffDelimiter
+		case "comment":
+			config.Comment, err = customerimporter.ParseCSVRune(*comment)
+		case "lazy-quotes":
+			config.LazyQuotes = *lazyQuotes
+		case "trim-leading-space":
+			config.TrimLeadingSpace = *trimLeadingSpace
+		case "keep-bom":
+			config.KeepBOM = *keepBOM
+		case "no-header":
+			config.NoHeader = *noHeader
+		}
+		if err != nil {
+			flagErrs = append(flagErrs, fmt.Errorf("invalid value %q for flag -%s: %w", f.Value, f.Name, err))
+		}
+	})
+
+	if err := errors.Join(flagErrs...); err != nil {
+		fmt.Fprintln(flags.Output(), err)
+		flags.Usage()
+		return exitUsage
+	}
 
-	err = customerimporter.Run(log, config)
+	writer, err := customerimporter.NewResultWriter(config.OutputFormat)
 	if err != nil {
-		log.Error("CSV import failed.", err)
-		return
+		fmt.Fprintln(flags.Output(), err)
+		flags.Usage()
+		return exitUsage
+	}
+
+	inputs := flags.Args()
+	if len(inputs) > 0 {
+		config.InputCSVFilePathDefault = "" // Not read, so a stale default doesn't fail the import.
+	}
+
+	if err := config.Validate(); err != nil {
+		fmt.Fprintln(flags.Output(), err)
+		flags.Usage()
+		return exitUsage
+	}
+
+	if len(inputs) == 0 {
+		if config.InputCSVFilePathDefault == "" {
+			fmt.Fprintln(flags.Output(), "no input given and INPUT_CSV_FILE_PATH_DEFAULT isn't set")
+			flags.Usage()
+			return exitUsage
+		}
+		inputs = []string{config.InputCSVFilePathDefault}
+	}
+
+	output, err := customerimporter.OpenOutput(config.OutputFilePath)
+	if err != nil {
+		log.Error("Creating output file failed.", slog.Any("error", err))
+		return exitError
+	}
+	defer output.Close()
+
+	// SIGINT and SIGTERM cancel the import, the partial report of the rows read so far is still written.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	start := time.Now()
+
+	// All the inputs are merged into one report, with the subtotals of each file.
+	result, err := customerimporter.RunFiles(ctx, log, config, inputs...)
+	if err != nil && result == nil {
+		log.Error("CSV import failed.", slog.Any("inputs", inputs), slog.Any("error", err))
+		return exitError
+	}
+
+	if err := writer.Write(output, result); err != nil {
+		log.Error("Writing report failed.", slog.Any("error", err))
+		return exitError
+	}
+
+	if err != nil { // Cancelled or timed out, the report holds the partial counts.
+		log.Error("CSV import stopped.", slog.Int("rows_read", result.RowsRead), slog.Any("error", err))
+		if errors.Is(err, context.Canceled) {
+			return exitInterrupted
+		}
+		return exitError
+	}
+
+	for _, file := range result.Files {
+		log.Info("Input processed.",
+			slog.String("input", file.Path),
+			slog.Int("rows_read", file.RowsRead),
+			slog.Int("rows_rejected", file.RowsRejected),
+			slog.Any("errors_by_reason", file.ErrorsByReason),
+			slog.String("time_taken", file.Duration.String()),
+		)
 	}
 
 	log.Info("Program finished.", slog.String("time_taken", time.Since(start).String()))
+
+	return exitOK
 }
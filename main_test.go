@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunFlagsOverrideEnv(t *testing.T) {
+	testCases := []struct {
+		name             string
+		env              map[string]string
+		args             []string
+		expectedExitCode int
+		expectedLines    int
+	}{
+		{
+			name:             "Invalid env value",
+			env:              map[string]string{"CONCURRENCY": "0"},
+			expectedExitCode: exitUsage,
+		},
+		{
+			name:             "Flag fixing an invalid env value",
+			env:              map[string]string{"CONCURRENCY": "0"},
+			args:             []string{"--concurrency", "2"},
+			expectedExitCode: exitOK,
+			expectedLines:    7, // The header line and the 6 domains.
+		},
+		{
+			name:             "Flag overriding a valid env value",
+			env:              map[string]string{"TOP": "1"},
+			args:             []string{"--top", "2"},
+			expectedExitCode: exitOK,
+			expectedLines:    3,
+		},
+		{
+			name:             "Stale default input with an input given",
+			env:              map[string]string{"INPUT_CSV_FILE_PATH_DEFAULT": "/nonexistent/customers.csv"},
+			expectedExitCode: exitOK,
+			expectedLines:    7,
+		},
+		{
+			name:             "Env value without a flag",
+			env:              map[string]string{"TOP": "1"},
+			expectedExitCode: exitOK,
+			expectedLines:    2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+			output := filepath.Join(t.TempDir(), "report.csv")
+			args := append([]string{"--format", "csv", "--output", output}, tc.args...)
+			args = append(args, "data/test/customers_10_lines.csv")
+
+			// When
+			exitCode := run(args)
+
+			// Then
+			if exitCode != tc.expectedExitCode {
+				t.Fatalf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedExitCode, exitCode)
+			}
+			if tc.expectedExitCode != exitOK {
+				return
+			}
+
+			report, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatalf("Error reading the report: %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(report)), "\n")
+			if len(lines) != tc.expectedLines {
+				t.Errorf("Test %s failed. Expected: %v, Got: %v", tc.name, tc.expectedLines, lines)
+			}
+		})
+	}
+}
+
+func TestRunWithoutInputs(t *testing.T) {
+	// Given
+	t.Setenv("INPUT_CSV_FILE_PATH_DEFAULT", "") // Set, so the .env file doesn't set it.
+
+	// When
+	exitCode := run([]string{"--output", filepath.Join(t.TempDir(), "report.txt")})
+
+	// Then
+	if exitCode != exitUsage {
+		t.Errorf("Unexpected exit code. Expected: %v, Got: %v", exitUsage, exitCode)
+	}
+}